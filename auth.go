@@ -0,0 +1,93 @@
+package oneworld
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// How long to wait for the session server before refusing the login
+const authTimeout = 10 * time.Second
+
+// Longest response read from the session server
+const maxAuthResponse = 64
+
+var errAuthFailed = errors.New("failed to verify username")
+
+// Enables online mode, where players must prove they own their username by
+// joining the server through a session server. sessionURL is an endpoint that
+// behaves like the legacy checkserver.jsp: it's requested with the user and
+// serverId query parameters and responds with YES if the player joined. An
+// empty URL returns to offline mode, which allows any username.
+func (listener *Listener) SetSessionServer(sessionURL string) error {
+	if sessionURL != "" {
+		if _, err := url.Parse(sessionURL); err != nil {
+			return err
+		}
+	}
+
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	listener.sessionURL = sessionURL
+	return nil
+}
+
+func (listener *Listener) sessionServer() string {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	return listener.sessionURL
+}
+
+// Generates the ID the client sends to the session server when joining.
+// Clients treat "-" as offline mode.
+func newServerId() (string, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// Asks the session server whether the player joined with the server ID
+func (listener *Listener) verifyUsername(sessionURL, username, serverId string) error {
+	requestURL, err := url.Parse(sessionURL)
+	if err != nil {
+		return err
+	}
+
+	query := requestURL.Query()
+	query.Set("user", username)
+	query.Set("serverId", serverId)
+	requestURL.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(listener.ctx, http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := listener.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("session server responded with %s", response.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxAuthResponse))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(string(body)) != "YES" {
+		return errAuthFailed
+	}
+	return nil
+}
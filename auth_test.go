@@ -0,0 +1,85 @@
+package oneworld
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+// A session server that accepts players who have joined with the server ID
+type stubSessionServer struct {
+	mu     sync.Mutex
+	joined map[string]string
+}
+
+func (stub *stubSessionServer) join(username, serverId string) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	stub.joined[username] = serverId
+}
+
+func (stub *stubSessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	query := r.URL.Query()
+	if serverId, ok := stub.joined[query.Get("user")]; ok && serverId == query.Get("serverId") {
+		fmt.Fprint(w, "YES")
+	} else {
+		fmt.Fprint(w, "NO")
+	}
+}
+
+func newAuthListener(t *testing.T) (*Listener, *stubSessionServer) {
+	stub := &stubSessionServer{joined: make(map[string]string)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	listener := newTestListener(t)
+	if err := listener.SetSessionServer(server.URL + "/game/checkserver.jsp"); err != nil {
+		t.Fatal(err)
+	}
+	return listener, stub
+}
+
+func TestOnlineModeLogin(t *testing.T) {
+	listener, stub := newAuthListener(t)
+
+	conn := dialListener(t, listener, (&protocol.HandshakePacket{Username: "Notch"}).Marshal())
+	var response protocol.HandshakePacket
+	if err := protocol.ExpectPacket(conn.reader, protocol.HandshakeId, &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Username == "-" {
+		t.Fatal("server responded in offline mode")
+	}
+
+	stub.join("Notch", response.Username)
+	conn.write(t, (&protocol.LoginPacket{ProtocolVersion: protocolVersion, Username: "Notch"}).Marshal())
+
+	accepted := waitForConnection(t, listener)
+	if accepted.Username != "Notch" {
+		t.Fatalf("accepted %s", accepted.Username)
+	}
+}
+
+func TestOnlineModeImpersonation(t *testing.T) {
+	listener, _ := newAuthListener(t)
+
+	handshake := &protocol.HandshakePacket{Username: "Notch"}
+	login := &protocol.LoginPacket{ProtocolVersion: protocolVersion, Username: "Notch"}
+	conn := dialListener(t, listener, handshake.Marshal(), login.Marshal())
+
+	var response protocol.HandshakePacket
+	if err := protocol.ExpectPacket(conn.reader, protocol.HandshakeId, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if message := expectKick(t, conn.reader); message != "Failed to verify username!" {
+		t.Fatalf("kicked for %q", message)
+	}
+}
@@ -0,0 +1,93 @@
+package oneworld
+
+import (
+	"sort"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+// Most changes sent in one multi block change packet
+const maxMultiBlockChanges = 1024
+
+// Sends the block to the player at the end of the tick. Changes to the same
+// chunk are sent together, and only the last change to each block is sent.
+func (player *PlayerBase[S]) SendBlockChange(x int, y int, z int, block blocks.Block) {
+	if player.disconnected || y < 0 || y >= 128 {
+		return
+	}
+
+	pos := ChunkPos{x >> 4, z >> 4}
+	changes, ok := player.pendingBlockChanges[pos]
+	if !ok {
+		changes = make(map[int16]blocks.Block)
+		player.pendingBlockChanges[pos] = changes
+	}
+	changes[int16((x&15)<<12|(z&15)<<8|y)] = block
+}
+
+// Queues the pending block changes. A chunk with one change is sent as a
+// normal block change, and a chunk with several as multi block changes.
+func (player *PlayerBase[S]) flushBlockChanges() {
+	if len(player.pendingBlockChanges) == 0 {
+		return
+	}
+
+	chunks := make([]ChunkPos, 0, len(player.pendingBlockChanges))
+	for pos := range player.pendingBlockChanges {
+		chunks = append(chunks, pos)
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].X < chunks[j].X || chunks[i].X == chunks[j].X && chunks[i].Z < chunks[j].Z
+	})
+
+	for _, chunkPos := range chunks {
+		changes := player.pendingBlockChanges[chunkPos]
+		delete(player.pendingBlockChanges, chunkPos)
+
+		positions := make([]int16, 0, len(changes))
+		for pos := range changes {
+			positions = append(positions, pos)
+		}
+		sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+		if len(positions) == 1 {
+			pos := positions[0]
+			block := changes[pos]
+			player.queuePacket(&protocol.BlockChangePacket{
+				X:    int32(chunkPos.X*16 + int(pos>>12&15)),
+				Y:    byte(pos & 0xFF),
+				Z:    int32(chunkPos.Z*16 + int(pos>>8&15)),
+				Type: byte(block.Type),
+				Data: byte(block.Data),
+			})
+			continue
+		}
+
+		for start := 0; start < len(positions); start += maxMultiBlockChanges {
+			end := start + maxMultiBlockChanges
+			if end > len(positions) {
+				end = len(positions)
+			}
+
+			packet := &protocol.MultiBlockChangePacket{
+				ChunkX:    int32(chunkPos.X),
+				ChunkZ:    int32(chunkPos.Z),
+				Positions: positions[start:end],
+				Types:     make([]byte, end-start),
+				Data:      make([]byte, end-start),
+			}
+			for i, pos := range packet.Positions {
+				packet.Types[i] = byte(changes[pos].Type)
+				packet.Data[i] = byte(changes[pos].Data)
+			}
+			player.queuePacket(packet)
+		}
+	}
+}
+
+// Sends everything queued during the tick
+func (player *PlayerBase[S]) flushPackets() {
+	player.flushBlockChanges()
+	player.outbound.flush()
+}
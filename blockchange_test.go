@@ -0,0 +1,178 @@
+package oneworld
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+func TestCoalesceBlockChanges(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+
+	player.SendBlockChange(1, 10, 2, blocks.Block{Type: blocks.Dirt})
+	player.SendBlockChange(3, 11, 4, blocks.Block{Type: blocks.Wool, Data: 5})
+	// Replaces the first change
+	player.SendBlockChange(1, 10, 2, blocks.Block{Type: blocks.Stone})
+	player.SendBlockChange(17, 5, 0, blocks.Block{Type: blocks.Glass})
+
+	player.flushBlockChanges()
+	packets := queuedPackets(player)
+	if len(packets) != 2 {
+		t.Fatalf("sent %d packets", len(packets))
+	}
+
+	multi := (&protocol.MultiBlockChangePacket{
+		ChunkX:    0,
+		ChunkZ:    0,
+		Positions: []int16{1<<12 | 2<<8 | 10, 3<<12 | 4<<8 | 11},
+		Types:     []byte{byte(blocks.Stone), byte(blocks.Wool)},
+		Data:      []byte{0, 5},
+	}).Marshal()
+	if !bytes.Equal(packets[0], multi) {
+		t.Errorf("expected multi block change %v but got %v", multi, packets[0])
+	}
+
+	single := (&protocol.BlockChangePacket{X: 17, Y: 5, Z: 0, Type: byte(blocks.Glass)}).Marshal()
+	if !bytes.Equal(packets[1], single) {
+		t.Errorf("expected block change %v but got %v", single, packets[1])
+	}
+}
+
+func TestChunkReplacesBlockChanges(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+
+	player.SendBlockChange(1, 10, 2, blocks.Block{Type: blocks.Dirt})
+	player.sendChunk(0, 0, player.Server.Chunk(0, 0))
+	player.flushBlockChanges()
+
+	packets := queuedPackets(player)
+	if len(packets) != 1 || packets[0][0] != protocol.ChunkDataId {
+		t.Fatalf("sent %d packets", len(packets))
+	}
+}
+
+func TestMultiBlockChangeMarshal(t *testing.T) {
+	packet := &protocol.MultiBlockChangePacket{
+		ChunkX:    -1,
+		ChunkZ:    2,
+		Positions: []int16{0x1234},
+		Types:     []byte{7},
+		Data:      []byte{3},
+	}
+
+	expected := []byte{
+		protocol.MultiBlockChangeId,
+		0xFF, 0xFF, 0xFF, 0xFF,
+		0, 0, 0, 2,
+		0, 1,
+		0x12, 0x34,
+		7,
+		3,
+	}
+	if actual := packet.Marshal(); !bytes.Equal(actual, expected) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
+
+// Connects to a local listener that discards everything it reads
+func newDiscardConn(b *testing.B) net.Conn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Block changes sent to a single chunk during one tick
+func benchmarkBlockChanges() []*protocol.BlockChangePacket {
+	packets := make([]*protocol.BlockChangePacket, 0, 256)
+	for x := int32(0); x < 16; x++ {
+		for z := int32(0); z < 16; z++ {
+			packets = append(packets, &protocol.BlockChangePacket{X: x, Y: 64, Z: z, Type: byte(blocks.Stone)})
+		}
+	}
+	return packets
+}
+
+// Writes every block change directly to the connection
+func BenchmarkWritePerPacket(b *testing.B) {
+	conn := newDiscardConn(b)
+	packets := benchmarkBlockChanges()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, packet := range packets {
+			if _, err := conn.Write(packet.Marshal()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// Writes every block change through a buffered writer flushed once per tick
+func BenchmarkWriteBuffered(b *testing.B) {
+	conn := newDiscardConn(b)
+	writer := bufio.NewWriterSize(conn, writeBufferSize)
+	packets := benchmarkBlockChanges()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, packet := range packets {
+			if _, err := writer.Write(packet.Marshal()); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Merges the block changes into one packet before the buffered write
+func BenchmarkWriteMerged(b *testing.B) {
+	conn := newDiscardConn(b)
+	writer := bufio.NewWriterSize(conn, writeBufferSize)
+	packets := benchmarkBlockChanges()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		multi := &protocol.MultiBlockChangePacket{
+			Positions: make([]int16, 0, len(packets)),
+			Types:     make([]byte, 0, len(packets)),
+			Data:      make([]byte, 0, len(packets)),
+		}
+		for _, packet := range packets {
+			multi.Positions = append(multi.Positions, int16(packet.X<<12|packet.Z<<8|int32(packet.Y)))
+			multi.Types = append(multi.Types, packet.Type)
+			multi.Data = append(multi.Data, packet.Data)
+		}
+
+		if _, err := writer.Write(multi.Marshal()); err != nil {
+			b.Fatal(err)
+		}
+		if err := writer.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package blocks
+
+import "github.com/richgrov/oneworld/geom"
+
+var fullBlock = []geom.AABB{geom.NewAABB(0, 0, 0, 1, 1, 1)}
+
+// Thickness of doors and trapdoors
+const panelThickness = 0.1875
+
+// Returns the boxes that entities collide with, relative to the block's
+// position. Blocks that aren't solid have no boxes, except for deep enough
+// snow layers. Boxes may extend past the block, such as fences which are 1.5
+// blocks tall. The returned slice must not be modified.
+func (block Block) CollisionBoxes() []geom.AABB {
+	switch block.Type {
+	case Slab:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 0.5, 1)}
+
+	case WoodStairs, StoneStairs:
+		return stairBoxes(block.Data)
+
+	case Fence:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 1.5, 1)}
+
+	case WoodenDoor, IronDoor:
+		// The direction a door faces rotates by one step when it's opened
+		rotation := block.Data - 1
+		if block.Data&DoorOpen != 0 {
+			rotation = block.Data
+		}
+		return doorBoxes(rotation & 3)
+
+	case Trapdoor:
+		return trapdoorBoxes(block.Data)
+
+	case SnowLayer:
+		if block.Data&7 >= Snow4 {
+			return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 0.5, 1)}
+		}
+		return nil
+
+	case Bed:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 0.5625, 1)}
+
+	case Cake:
+		inset := 0.0625
+		eaten := float64(1+2*int(block.Data)) / 16
+		return []geom.AABB{geom.NewAABB(eaten, 0, inset, 1-inset, 0.5-inset, 1-inset)}
+
+	case Cactus:
+		inset := 0.0625
+		return []geom.AABB{geom.NewAABB(inset, 0, inset, 1-inset, 1-inset, 1-inset)}
+
+	case SoulSand:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 0.875, 1)}
+
+	case RepeaterOff, RepeaterOn:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 0.125, 1)}
+
+	default:
+		if block.Solid() {
+			return fullBlock
+		}
+		return nil
+	}
+}
+
+func stairBoxes(data BlockData) []geom.AABB {
+	var step geom.AABB
+	switch data {
+	case StairsEast:
+		step = geom.NewAABB(0.5, 0.5, 0, 1, 1, 1)
+	case StairsWest:
+		step = geom.NewAABB(0, 0.5, 0, 0.5, 1, 1)
+	case StairsSouth:
+		step = geom.NewAABB(0, 0.5, 0.5, 1, 1, 1)
+	default:
+		step = geom.NewAABB(0, 0.5, 0, 1, 1, 0.5)
+	}
+
+	return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 0.5, 1), step}
+}
+
+func doorBoxes(rotation BlockData) []geom.AABB {
+	switch rotation {
+	case 0:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 1, panelThickness)}
+	case 1:
+		return []geom.AABB{geom.NewAABB(1-panelThickness, 0, 0, 1, 1, 1)}
+	case 2:
+		return []geom.AABB{geom.NewAABB(0, 0, 1-panelThickness, 1, 1, 1)}
+	default:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, panelThickness, 1, 1)}
+	}
+}
+
+func trapdoorBoxes(data BlockData) []geom.AABB {
+	if data&TrapdoorUp == 0 {
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, panelThickness, 1)}
+	}
+
+	switch data & 3 {
+	case TrapdoorNorth:
+		return []geom.AABB{geom.NewAABB(0, 0, 1-panelThickness, 1, 1, 1)}
+	case TrapdoorSouth:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, 1, 1, panelThickness)}
+	case TrapdoorWest:
+		return []geom.AABB{geom.NewAABB(1-panelThickness, 0, 0, 1, 1, 1)}
+	default:
+		return []geom.AABB{geom.NewAABB(0, 0, 0, panelThickness, 1, 1)}
+	}
+}
@@ -5,6 +5,7 @@ const InstaBreak float32 = 0
 
 type blockProperties struct {
 	hardness float32
+	solid    bool
 }
 
 var properties = [...]blockProperties{
@@ -13,22 +14,27 @@ var properties = [...]blockProperties{
 	// Stone
 	{
 		hardness: 1.5,
+		solid:    true,
 	},
 	// Grass
 	{
 		hardness: 0.6,
+		solid:    true,
 	},
 	// Dirt
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// Cobblestone
 	{
 		hardness: 2.,
+		solid:    true,
 	},
 	// Planks
 	{
 		hardness: 2.,
+		solid:    true,
 	},
 	// Sapling
 	{
@@ -37,6 +43,7 @@ var properties = [...]blockProperties{
 	// Bedrock
 	{
 		hardness: Unbreakable,
+		solid:    true,
 	},
 	// FlowingWater
 	{
@@ -57,62 +64,77 @@ var properties = [...]blockProperties{
 	// Sand
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// Gravel
 	{
 		hardness: 0.6,
+		solid:    true,
 	},
 	// GoldOre
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// IronOre
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// CoalOre
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// Log
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Leaves
 	{
 		hardness: 0.2,
+		solid:    true,
 	},
 	// Sponge
 	{
 		hardness: 0.6,
+		solid:    true,
 	},
 	// Glass
 	{
 		hardness: 0.3,
+		solid:    true,
 	},
 	// LapisOre
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// LapisBlock
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// Dispenser
 	{
 		hardness: 3.5,
+		solid:    true,
 	},
 	// Sandstone
 	{
 		hardness: 0.8,
+		solid:    true,
 	},
 	// NoteBlock
 	{
 		hardness: 0.8,
+		solid:    true,
 	},
 	// Bed
 	{
 		hardness: 0.2,
+		solid:    true,
 	},
 	// PoweredRail
 	{
@@ -125,6 +147,7 @@ var properties = [...]blockProperties{
 	// StickyPiston
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// Web
 	{
@@ -141,14 +164,17 @@ var properties = [...]blockProperties{
 	// Piston
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// PistonHead
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// Wool
 	{
 		hardness: 0.8,
+		solid:    true,
 	},
 	// PistonExtension
 	{
@@ -173,38 +199,47 @@ var properties = [...]blockProperties{
 	// GoldBlock
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// IronBlock
 	{
 		hardness: 5,
+		solid:    true,
 	},
 	// DoubleSlab
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Slab
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Bricks
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Tnt
 	{
 		hardness: InstaBreak,
+		solid:    true,
 	},
 	// Bookshelf
 	{
 		hardness: 1.5,
+		solid:    true,
 	},
 	// MossStone
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Obsidian
 	{
 		hardness: 10,
+		solid:    true,
 	},
 	// Torch
 	{
@@ -217,14 +252,17 @@ var properties = [...]blockProperties{
 	// Spawner
 	{
 		hardness: 5,
+		solid:    true,
 	},
 	// WoodStairs
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Chest
 	{
 		hardness: 2.5,
+		solid:    true,
 	},
 	// Redstone
 	{
@@ -233,14 +271,17 @@ var properties = [...]blockProperties{
 	// DiamondOre
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// DiamondBlock
 	{
 		hardness: 5,
+		solid:    true,
 	},
 	// CraftingTable
 	{
 		hardness: 2.5,
+		solid:    true,
 	},
 	// Wheat
 	{
@@ -249,14 +290,17 @@ var properties = [...]blockProperties{
 	// Farmland
 	{
 		hardness: 0.6,
+		solid:    true,
 	},
 	// Furnace
 	{
 		hardness: 3.5,
+		solid:    true,
 	},
 	// LitFurnace
 	{
 		hardness: 3.5,
+		solid:    true,
 	},
 	// StandingSign
 	{
@@ -265,6 +309,7 @@ var properties = [...]blockProperties{
 	// WoodenDoor
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// Ladder
 	{
@@ -277,6 +322,7 @@ var properties = [...]blockProperties{
 	// StoneStairs
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// WallSign
 	{
@@ -293,6 +339,7 @@ var properties = [...]blockProperties{
 	// IronDoor
 	{
 		hardness: 5,
+		solid:    true,
 	},
 	// WoodPressurePlate
 	{
@@ -301,10 +348,12 @@ var properties = [...]blockProperties{
 	// RedstoneOre
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// PoweredRedstoneOre
 	{
 		hardness: 3,
+		solid:    true,
 	},
 	// RedstoneTorchOff
 	{
@@ -325,18 +374,22 @@ var properties = [...]blockProperties{
 	// Ice
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// Snow
 	{
 		hardness: 0.2,
+		solid:    true,
 	},
 	// Cactus
 	{
 		hardness: 0.4,
+		solid:    true,
 	},
 	// Clay
 	{
 		hardness: 0.6,
+		solid:    true,
 	},
 	// SugarCane
 	{
@@ -345,26 +398,32 @@ var properties = [...]blockProperties{
 	// Jukebox
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Fence
 	{
 		hardness: 2,
+		solid:    true,
 	},
 	// Pumpkin
 	{
 		hardness: 1,
+		solid:    true,
 	},
 	// Netherrack
 	{
 		hardness: 0.4,
+		solid:    true,
 	},
 	// SoulSand
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// Glowstone
 	{
 		hardness: 0.3,
+		solid:    true,
 	},
 	// Portal
 	{
@@ -373,29 +432,42 @@ var properties = [...]blockProperties{
 	// JackOLantern
 	{
 		hardness: 1,
+		solid:    true,
 	},
 	// Cake
 	{
 		hardness: 0.5,
+		solid:    true,
 	},
 	// RepeaterOff
 	{
 		hardness: InstaBreak,
+		solid:    true,
 	},
 	// RepeaterOn
 	{
 		hardness: InstaBreak,
+		solid:    true,
 	},
 	// LockedChest
 	{
 		hardness: InstaBreak,
+		solid:    true,
 	},
 	// Trapdoor
 	{
 		hardness: 3,
+		solid:    true,
 	},
 }
 
 func (block Block) Hardness() float32 {
 	return properties[byte(block.Type)].hardness
 }
+
+// Whether entities collide with the block. Doors are always considered solid
+// regardless of whether they are open, though pathfinding treats wooden doors
+// as passable.
+func (block Block) Solid() bool {
+	return properties[byte(block.Type)].solid
+}
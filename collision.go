@@ -0,0 +1,127 @@
+package oneworld
+
+import (
+	"math"
+
+	"github.com/richgrov/oneworld/geom"
+)
+
+// Size of the hitbox of players and most mobs
+const (
+	entityWidth  = 0.6
+	entityHeight = 1.8
+)
+
+// Returns the collision boxes, in world coordinates, of every block that
+// intersects the box
+func (server *Server) BlockCollisions(box geom.AABB) []geom.AABB {
+	collisions := make([]geom.AABB, 0)
+
+	minX := int(math.Floor(box.Min.X))
+	// Some blocks such as fences extend into the block above them
+	minY := int(math.Floor(box.Min.Y)) - 1
+	minZ := int(math.Floor(box.Min.Z))
+	maxX := int(math.Floor(box.Max.X))
+	maxY := int(math.Floor(box.Max.Y))
+	maxZ := int(math.Floor(box.Max.Z))
+
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			for z := minZ; z <= maxZ; z++ {
+				offset := geom.Vec3{X: float64(x), Y: float64(y), Z: float64(z)}
+
+				for _, blockBox := range server.GetBlock(x, y, z).CollisionBoxes() {
+					if worldBox := blockBox.Offset(offset); worldBox.Intersects(box) {
+						collisions = append(collisions, worldBox)
+					}
+				}
+			}
+		}
+	}
+
+	return collisions
+}
+
+// Returns how far the box can be moved before colliding with blocks. See
+// geom.AABB.Sweep.
+func (server *Server) SweepAABB(box geom.AABB, movement geom.Vec3) geom.Vec3 {
+	return box.Sweep(movement, server.BlockCollisions(box.Expand(movement)))
+}
+
+// Returns the first block whose collision boxes are hit by the ray, the
+// distance along the ray at which it was hit, and the face that was hit.
+func (server *Server) RaycastBlocks(ray geom.Ray, maxDistance float64) (BlockPos, float64, geom.Face, bool) {
+	pos := BlockPos{
+		X: int(math.Floor(ray.Origin.X)),
+		Y: int(math.Floor(ray.Origin.Y)),
+		Z: int(math.Floor(ray.Origin.Z)),
+	}
+
+	stepX, nextX, deltaX := raycastAxis(ray.Origin.X, ray.Direction.X)
+	stepY, nextY, deltaY := raycastAxis(ray.Origin.Y, ray.Direction.Y)
+	stepZ, nextZ, deltaZ := raycastAxis(ray.Origin.Z, ray.Direction.Z)
+
+	for distance := 0.; distance <= maxDistance; {
+		if hitPos, hitDistance, face, ok := server.raycastBlock(ray, pos, maxDistance); ok {
+			return hitPos, hitDistance, face, true
+		}
+
+		if nextX < nextY && nextX < nextZ {
+			pos.X += stepX
+			distance = nextX
+			nextX += deltaX
+		} else if nextY < nextZ {
+			pos.Y += stepY
+			distance = nextY
+			nextY += deltaY
+		} else {
+			pos.Z += stepZ
+			distance = nextZ
+			nextZ += deltaZ
+		}
+	}
+
+	return BlockPos{}, 0, 0, false
+}
+
+// Tests the ray against the boxes of the block at pos, as well as any boxes
+// of the block below that extend into it
+func (server *Server) raycastBlock(ray geom.Ray, pos BlockPos, maxDistance float64) (BlockPos, float64, geom.Face, bool) {
+	hit := false
+	var hitPos BlockPos
+	var hitFace geom.Face
+	hitDistance := maxDistance
+
+	for _, candidate := range [...]BlockPos{pos, {pos.X, pos.Y - 1, pos.Z}} {
+		offset := geom.Vec3{X: float64(candidate.X), Y: float64(candidate.Y), Z: float64(candidate.Z)}
+
+		for _, box := range server.GetBlock(candidate.X, candidate.Y, candidate.Z).CollisionBoxes() {
+			if candidate != pos && box.Max.Y <= 1 {
+				continue
+			}
+
+			if distance, face, ok := box.Offset(offset).IntersectRay(ray, hitDistance); ok {
+				hit = true
+				hitPos = candidate
+				hitFace = face
+				hitDistance = distance
+			}
+		}
+	}
+
+	return hitPos, hitDistance, hitFace, hit
+}
+
+// Returns the direction of travel along an axis, the distance traveled before
+// crossing the first block boundary, and the distance traveled between each
+// boundary after that
+func raycastAxis(pos, direction float64) (int, float64, float64) {
+	switch {
+	case direction > 0:
+		return 1, (math.Floor(pos) + 1 - pos) / direction, 1 / direction
+	case direction < 0:
+		return -1, (pos - math.Floor(pos)) / -direction, 1 / -direction
+	default:
+		return 0, math.Inf(1), math.Inf(1)
+	}
+}
@@ -0,0 +1,79 @@
+package oneworld
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/geom"
+)
+
+const collisionFloorY = 9
+
+// Creates a single-chunk world with a stone floor and the blocks placed by
+// build
+func newCollisionWorld(t *testing.T, build func(chunk *Chunk)) *Server {
+	chunk := new(Chunk)
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			chunk.Set(x, collisionFloorY, z, blocks.Block{Type: blocks.Stone})
+		}
+	}
+	build(chunk)
+
+	server, err := NewServer(1, []*Chunk{chunk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+	return server
+}
+
+func TestSweepOntoBlocks(t *testing.T) {
+	world := newCollisionWorld(t, func(chunk *Chunk) {
+		chunk.Set(2, collisionFloorY+1, 2, blocks.Block{Type: blocks.Slab})
+		chunk.Set(4, collisionFloorY+1, 4, blocks.Block{Type: blocks.Fence})
+		chunk.Set(6, collisionFloorY+1, 6, blocks.Block{Type: blocks.SnowLayer, Data: blocks.Snow1})
+		chunk.Set(8, collisionFloorY+1, 8, blocks.Block{Type: blocks.SnowLayer, Data: blocks.Snow4})
+	})
+
+	tests := map[geom.Vec3]float64{
+		{X: 2.5, Y: 15, Z: 2.5}:   collisionFloorY + 1.5,
+		{X: 4.5, Y: 15, Z: 4.5}:   collisionFloorY + 2.5,
+		{X: 6.5, Y: 15, Z: 6.5}:   collisionFloorY + 1,
+		{X: 8.5, Y: 15, Z: 8.5}:   collisionFloorY + 1.5,
+		{X: 10.5, Y: 15, Z: 10.5}: collisionFloorY + 1,
+	}
+
+	for start, expectedY := range tests {
+		box := geom.EntityAABB(start, 0.6, 1.8)
+		movement := world.SweepAABB(box, geom.Vec3{Y: -10})
+		if y := start.Y + movement.Y; math.Abs(y-expectedY) > 1e-9 {
+			t.Errorf("box dropped at %v landed at y=%f, expected %f", start, y, expectedY)
+		}
+	}
+}
+
+func TestRaycastBlocks(t *testing.T) {
+	world := newCollisionWorld(t, func(chunk *Chunk) {
+		chunk.Set(5, collisionFloorY+1, 1, blocks.Block{Type: blocks.Fence})
+	})
+
+	// Passes over the bottom half of the fence but through the part that
+	// extends into the block above
+	ray := geom.Ray{
+		Origin:    geom.Vec3{X: 1.5, Y: collisionFloorY + 2.25, Z: 1.5},
+		Direction: geom.Vec3{X: 1},
+	}
+
+	pos, distance, face, hit := world.RaycastBlocks(ray, 10)
+	if !hit || pos != (BlockPos{X: 5, Y: collisionFloorY + 1, Z: 1}) || face != geom.FaceNegativeX || math.Abs(distance-3.5) > 1e-9 {
+		t.Fatalf("unexpected hit %v %v at %f on face %d", hit, pos, distance, face)
+	}
+
+	ray.Origin.Y = collisionFloorY + 2.75
+	if pos, _, _, hit := world.RaycastBlocks(ray, 10); hit {
+		t.Fatalf("ray above fence hit %v", pos)
+	}
+}
@@ -0,0 +1,286 @@
+package oneworld
+
+import (
+	"math"
+	"time"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+	"github.com/richgrov/oneworld/items"
+)
+
+// Fraction of the expected break time a player must have dug for before a
+// finish is accepted. Allows for packets arriving unevenly.
+const digTimeTolerance = 0.75
+
+// How much slower digging is when underwater or not on the ground
+const digPenalty = 5
+
+type toolKind byte
+
+const (
+	noTool toolKind = iota
+	pickaxe
+	shovel
+	axe
+	sword
+	shears
+)
+
+type toolMaterial struct {
+	efficiency   float64
+	harvestLevel int
+}
+
+var (
+	woodTool    = toolMaterial{efficiency: 2, harvestLevel: 0}
+	stoneTool   = toolMaterial{efficiency: 4, harvestLevel: 1}
+	ironTool    = toolMaterial{efficiency: 6, harvestLevel: 2}
+	diamondTool = toolMaterial{efficiency: 8, harvestLevel: 3}
+	goldTool    = toolMaterial{efficiency: 12, harvestLevel: 0}
+)
+
+type tool struct {
+	kind     toolKind
+	material toolMaterial
+}
+
+var tools = map[items.ItemId]tool{
+	items.WoodPickaxe:    {pickaxe, woodTool},
+	items.StonePickaxe:   {pickaxe, stoneTool},
+	items.IronPickaxe:    {pickaxe, ironTool},
+	items.DiamondPickaxe: {pickaxe, diamondTool},
+	items.GoldPickaxe:    {pickaxe, goldTool},
+	items.WoodShovel:     {shovel, woodTool},
+	items.StoneShovel:    {shovel, stoneTool},
+	items.IronShovel:     {shovel, ironTool},
+	items.DiamondShovel:  {shovel, diamondTool},
+	items.GoldShovel:     {shovel, goldTool},
+	items.WoodAxe:        {axe, woodTool},
+	items.StoneAxe:       {axe, stoneTool},
+	items.IronAxe:        {axe, ironTool},
+	items.DiamondAxe:     {axe, diamondTool},
+	items.GoldAxe:        {axe, goldTool},
+	items.WoodSword:      {sword, woodTool},
+	items.StoneSword:     {sword, stoneTool},
+	items.IronSword:      {sword, ironTool},
+	items.DiamondSword:   {sword, diamondTool},
+	items.GoldSword:      {sword, goldTool},
+	items.Shears:         {kind: shears},
+}
+
+// Minimum pickaxe harvest level needed for a block to drop anything. Blocks
+// that aren't listed here or in requiresPickaxe can be harvested by hand.
+var pickaxeHarvestLevels = map[blocks.BlockType]int{
+	blocks.Obsidian:           3,
+	blocks.DiamondOre:         2,
+	blocks.DiamondBlock:       2,
+	blocks.GoldOre:            2,
+	blocks.GoldBlock:          2,
+	blocks.RedstoneOre:        2,
+	blocks.PoweredRedstoneOre: 2,
+	blocks.IronOre:            1,
+	blocks.IronBlock:          1,
+	blocks.LapisOre:           1,
+	blocks.LapisBlock:         1,
+}
+
+// Blocks made of stone or metal that only drop when mined with a pickaxe
+var requiresPickaxe = map[blocks.BlockType]bool{
+	blocks.Stone:              true,
+	blocks.Cobblestone:        true,
+	blocks.MossStone:          true,
+	blocks.Sandstone:          true,
+	blocks.DoubleSlab:         true,
+	blocks.Slab:               true,
+	blocks.Bricks:             true,
+	blocks.StoneStairs:        true,
+	blocks.CoalOre:            true,
+	blocks.Dispenser:          true,
+	blocks.Furnace:            true,
+	blocks.LitFurnace:         true,
+	blocks.Spawner:            true,
+	blocks.IronDoor:           true,
+	blocks.StonePressurePlate: true,
+	blocks.Netherrack:         true,
+}
+
+// Blocks that each kind of tool digs faster
+var effectiveBlocks = map[toolKind]map[blocks.BlockType]bool{
+	pickaxe: {
+		blocks.Stone: true, blocks.Cobblestone: true, blocks.MossStone: true,
+		blocks.Sandstone: true, blocks.DoubleSlab: true, blocks.Slab: true,
+		blocks.CoalOre: true, blocks.IronOre: true, blocks.GoldOre: true,
+		blocks.DiamondOre: true, blocks.LapisOre: true, blocks.IronBlock: true,
+		blocks.GoldBlock: true, blocks.DiamondBlock: true, blocks.LapisBlock: true,
+		blocks.Ice: true, blocks.Netherrack: true,
+	},
+	shovel: {
+		blocks.Grass: true, blocks.Dirt: true, blocks.Sand: true,
+		blocks.Gravel: true, blocks.SnowLayer: true, blocks.Snow: true,
+		blocks.Clay: true, blocks.Farmland: true, blocks.SoulSand: true,
+	},
+	axe: {
+		blocks.Planks: true, blocks.Bookshelf: true, blocks.Log: true,
+		blocks.Chest: true,
+	},
+}
+
+// How many times faster the tool digs the block than a bare hand
+func (tool tool) strengthAgainst(block blocks.BlockType) float64 {
+	switch tool.kind {
+	case sword:
+		if block == blocks.Web {
+			return 15
+		}
+		return 1.5
+
+	case shears:
+		switch block {
+		case blocks.Web, blocks.Leaves:
+			return 15
+		case blocks.Wool:
+			return 5
+		}
+		return 1
+
+	default:
+		if effectiveBlocks[tool.kind][block] {
+			return tool.material.efficiency
+		}
+		return 1
+	}
+}
+
+// Whether the block drops anything when broken with the tool. Blocks that
+// can't be harvested take much longer to break.
+func (tool tool) canHarvest(block blocks.BlockType) bool {
+	switch block {
+	case blocks.Snow, blocks.SnowLayer:
+		return tool.kind == shovel
+	case blocks.Web:
+		return tool.kind == sword || tool.kind == shears
+	}
+
+	level, hasLevel := pickaxeHarvestLevels[block]
+	if !hasLevel && !requiresPickaxe[block] {
+		return true
+	}
+	return tool.kind == pickaxe && tool.material.harvestLevel >= level
+}
+
+// Returns how long it takes to break the block with the tool, or false if it
+// can't be broken
+func breakTime(block blocks.Block, heldItem items.ItemId, underwater, onGround bool) (time.Duration, bool) {
+	hardness := float64(block.Hardness())
+	if hardness < 0 {
+		return 0, false
+	}
+	if hardness == 0 {
+		return 0, true
+	}
+
+	held := tools[heldItem]
+	var progressPerTick float64
+	if held.canHarvest(block.Type) {
+		strength := held.strengthAgainst(block.Type)
+		if underwater {
+			strength /= digPenalty
+		}
+		if !onGround {
+			strength /= digPenalty
+		}
+		progressPerTick = strength / hardness / 30
+	} else {
+		progressPerTick = 1 / hardness / 100
+	}
+
+	if progressPerTick >= 1 {
+		return 0, true
+	}
+
+	ticks := math.Ceil(1 / progressPerTick)
+	return time.Duration(ticks) * time.Second / ticksPerSecond, true
+}
+
+// Returns how long it would take the player to break the block with the item
+// they're holding, or false if the block can't be broken
+func (player *PlayerBase[S]) BreakTime(block blocks.Block) (time.Duration, bool) {
+	return breakTime(block, items.ItemId(player.HeldItem().Id), player.isUnderwater(), player.movement.onGround)
+}
+
+func (player *PlayerBase[S]) isUnderwater() bool {
+	block := player.Server.GetBlock(
+		int(math.Floor(player.x)),
+		int(math.Floor(player.y+playerEyeHeight)),
+		int(math.Floor(player.z)),
+	)
+	return block.Type == blocks.Water || block.Type == blocks.FlowingWater
+}
+
+// Returns whether the block at the coordinates should be destroyed in
+// response to a dig packet. If the player claims to have finished breaking the
+// block sooner than possible, the real block is resent and a violation is
+// reported.
+func (player *PlayerBase[S]) validateDig(status byte, x, y, z int) bool {
+	block := player.Server.GetBlock(x, y, z)
+	pos := BlockPos{x, y, z}
+
+	switch status {
+	case protocol.DigStarted:
+		if !canTarget(block) {
+			// The client may not have been told that the block changed yet
+			player.digging = false
+			player.SendBlockChange(x, y, z, block)
+			return false
+		}
+
+		expected, breakable := player.BreakTime(block)
+		player.digging = breakable
+		player.digPos = pos
+		player.digStartTime = time.Now()
+		player.digExpectedTime = expected
+		// Blocks that break instantly are destroyed without the client
+		// sending a finish
+		return breakable && expected == 0
+
+	case protocol.DigFinished:
+		if !player.digging || player.digPos != pos {
+			player.rejectDig(x, y, z, block)
+			return false
+		}
+		player.digging = false
+
+		// Conditions may have changed since digging started, such as the
+		// player landing from a jump. Accept whichever is faster.
+		expected := player.digExpectedTime
+		if current, breakable := player.BreakTime(block); breakable && current < expected {
+			expected = current
+		}
+
+		elapsed := time.Since(player.digStartTime)
+		if elapsed.Seconds() < expected.Seconds()*digTimeTolerance {
+			player.rejectDig(x, y, z, block)
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+// Whether the client can aim at the block to dig it. Air and liquids have no
+// hardness, so digging them would otherwise count as breaking them instantly.
+func canTarget(block blocks.Block) bool {
+	switch block.Type {
+	case blocks.Air, blocks.Water, blocks.FlowingWater, blocks.Lava, blocks.FlowingLava, blocks.Fire:
+		return false
+	default:
+		return true
+	}
+}
+
+func (player *PlayerBase[S]) rejectDig(x, y, z int, block blocks.Block) {
+	player.SendBlockChange(x, y, z, block)
+	player.eventHandler.OnViolation(ViolationDigSpeed)
+}
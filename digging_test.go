@@ -0,0 +1,207 @@
+package oneworld
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/geom"
+	"github.com/richgrov/oneworld/internal/protocol"
+	"github.com/richgrov/oneworld/items"
+)
+
+func TestBreakTime(t *testing.T) {
+	tick := time.Second / ticksPerSecond
+
+	tests := []struct {
+		name       string
+		block      blocks.BlockType
+		held       items.ItemId
+		underwater bool
+		onGround   bool
+		expected   time.Duration
+	}{
+		{"dirt by hand", blocks.Dirt, 0, false, true, 15 * tick},
+		{"dirt with diamond shovel", blocks.Dirt, items.DiamondShovel, false, true, 2 * tick},
+		{"stone by hand", blocks.Stone, 0, false, true, 150 * tick},
+		{"stone with wooden pickaxe", blocks.Stone, items.WoodPickaxe, false, true, 23 * tick},
+		{"stone with gold pickaxe", blocks.Stone, items.GoldPickaxe, false, true, 4 * tick},
+		{"stone with wooden pickaxe in air", blocks.Stone, items.WoodPickaxe, false, false, 113 * tick},
+		{"dirt underwater in air", blocks.Dirt, 0, true, false, 375 * tick},
+		{"iron ore with wooden pickaxe", blocks.IronOre, items.WoodPickaxe, false, true, 300 * tick},
+		{"planks with sword", blocks.Planks, items.IronSword, false, true, 40 * tick},
+		{"leaves with shears", blocks.Leaves, items.Shears, false, true, 0},
+		{"torch", blocks.Torch, 0, false, false, 0},
+	}
+
+	for _, test := range tests {
+		actual, ok := breakTime(blocks.Block{Type: test.block}, test.held, test.underwater, test.onGround)
+		if !ok {
+			t.Errorf("%s: unbreakable", test.name)
+		} else if actual != test.expected {
+			t.Errorf("%s: expected %s but got %s", test.name, test.expected, actual)
+		}
+	}
+
+	if _, ok := breakTime(blocks.Block{Type: blocks.Bedrock}, items.DiamondPickaxe, false, true); ok {
+		t.Error("bedrock is breakable")
+	}
+}
+
+// Sends a dig packet for the top face of the block
+func sendDig(player *PlayerBase[*Server], status byte, x, y, z int) {
+	player.handlePacket(&protocol.DigPacket{
+		Status: status,
+		X:      int32(x),
+		Y:      byte(y),
+		Z:      int32(z),
+		Face:   byte(geom.FaceTop),
+	})
+}
+
+func expectDigs(t *testing.T, recorder *violationRecorder, expected ...digEvent) {
+	t.Helper()
+	if len(recorder.digs) != len(expected) {
+		t.Fatalf("expected digs %v but got %v", expected, recorder.digs)
+	}
+	for i := range expected {
+		if recorder.digs[i] != expected[i] {
+			t.Fatalf("expected digs %v but got %v", expected, recorder.digs)
+		}
+	}
+}
+
+// Checks that the block was sent to the player again
+func expectBlockResent(t *testing.T, player *PlayerBase[*Server], x, y, z int) {
+	t.Helper()
+	block := player.Server.GetBlock(x, y, z)
+	expected := (&protocol.BlockChangePacket{
+		X:    int32(x),
+		Y:    byte(y),
+		Z:    int32(z),
+		Type: byte(block.Type),
+		Data: byte(block.Data),
+	}).Marshal()
+
+	player.flushBlockChanges()
+	for _, packet := range queuedPackets(player) {
+		if bytes.Equal(packet, expected) {
+			return
+		}
+	}
+	t.Fatal("block wasn't resent")
+}
+
+func newDiggingPlayer(t *testing.T) (*PlayerBase[*Server], *violationRecorder) {
+	player, recorder := newMovementPlayer(t)
+	player.movement.onGround = true
+	queuedPackets(player)
+	return player, recorder
+}
+
+func TestDigFinishedEarly(t *testing.T) {
+	player, recorder := newDiggingPlayer(t)
+
+	sendDig(player, protocol.DigStarted, 9, movementFloorY, 8)
+	if !player.digging || player.digPos != (BlockPos{9, movementFloorY, 8}) {
+		t.Fatal("start of digging wasn't recorded")
+	}
+	if expected, _ := player.BreakTime(blocks.Block{Type: blocks.Stone}); player.digExpectedTime != expected {
+		t.Fatalf("expected to dig for %s but recorded %s", expected, player.digExpectedTime)
+	}
+
+	// Stone takes 7.5 seconds to break by hand
+	sendDig(player, protocol.DigFinished, 9, movementFloorY, 8)
+
+	expectDigs(t, recorder,
+		digEvent{BlockPos{9, movementFloorY, 8}, false},
+		digEvent{BlockPos{9, movementFloorY, 8}, false},
+	)
+	expectViolation(t, recorder, ViolationDigSpeed)
+	expectBlockResent(t, player, 9, movementFloorY, 8)
+}
+
+func TestDigFinishedInTime(t *testing.T) {
+	player, recorder := newDiggingPlayer(t)
+	player.items[hotbarSlotStart] = ItemStack{Id: uint16(items.DiamondPickaxe), Count: 1}
+
+	sendDig(player, protocol.DigStarted, 9, movementFloorY, 8)
+	// Pretend the player has been digging for as long as it takes
+	player.digStartTime = player.digStartTime.Add(-player.digExpectedTime)
+	sendDig(player, protocol.DigFinished, 9, movementFloorY, 8)
+
+	expectDigs(t, recorder,
+		digEvent{BlockPos{9, movementFloorY, 8}, false},
+		digEvent{BlockPos{9, movementFloorY, 8}, true},
+	)
+	if len(recorder.violations) != 0 {
+		t.Fatalf("unexpected violations %v", recorder.violations)
+	}
+	if player.digging {
+		t.Fatal("player is still digging")
+	}
+}
+
+func TestDigFinishedOnOtherBlock(t *testing.T) {
+	player, recorder := newDiggingPlayer(t)
+
+	sendDig(player, protocol.DigStarted, 9, movementFloorY, 8)
+	player.digStartTime = player.digStartTime.Add(-time.Minute)
+	// A different block than the one being dug
+	sendDig(player, protocol.DigFinished, 9, movementFloorY, 9)
+
+	expectDigs(t, recorder,
+		digEvent{BlockPos{9, movementFloorY, 8}, false},
+		digEvent{BlockPos{9, movementFloorY, 9}, false},
+	)
+	expectViolation(t, recorder, ViolationDigSpeed)
+	expectBlockResent(t, player, 9, movementFloorY, 9)
+}
+
+func TestInstantBreak(t *testing.T) {
+	player, recorder := newDiggingPlayer(t)
+	player.Server.SetBlock(9, movementFloorY+1, 8, blocks.Block{Type: blocks.Torch})
+
+	// The client doesn't send a finish for blocks that break instantly
+	sendDig(player, protocol.DigStarted, 9, movementFloorY+1, 8)
+
+	expectDigs(t, recorder, digEvent{BlockPos{9, movementFloorY + 1, 8}, true})
+	if len(recorder.violations) != 0 {
+		t.Fatalf("unexpected violations %v", recorder.violations)
+	}
+}
+
+func TestDigUntargetableBlock(t *testing.T) {
+	for _, block := range []blocks.BlockType{blocks.Air, blocks.Water, blocks.Lava} {
+		player, recorder := newDiggingPlayer(t)
+		player.Server.SetBlock(9, movementFloorY+1, 8, blocks.Block{Type: block})
+		queuedPackets(player)
+
+		sendDig(player, protocol.DigStarted, 9, movementFloorY+1, 8)
+		expectDigs(t, recorder, digEvent{BlockPos{9, movementFloorY + 1, 8}, false})
+		expectBlockResent(t, player, 9, movementFloorY+1, 8)
+
+		// Nothing was being dug
+		sendDig(player, protocol.DigFinished, 9, movementFloorY+1, 8)
+		if recorder.digs[1].finished {
+			t.Fatalf("block %d was destroyed", block)
+		}
+	}
+}
+
+func TestPlayerBreakTime(t *testing.T) {
+	player, _ := newDiggingPlayer(t)
+	player.items[hotbarSlotStart] = ItemStack{Id: uint16(items.WoodPickaxe), Count: 1}
+	stone := blocks.Block{Type: blocks.Stone}
+	tick := time.Second / ticksPerSecond
+
+	if actual, ok := player.BreakTime(stone); !ok || actual != 23*tick {
+		t.Errorf("on the ground: took %s", actual)
+	}
+
+	player.movement.onGround = false
+	if actual, ok := player.BreakTime(stone); !ok || actual != 113*tick {
+		t.Errorf("in the air: took %s", actual)
+	}
+}
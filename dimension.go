@@ -3,7 +3,22 @@ package oneworld
 type Dimension int8
 
 const (
-	Nether = iota - 1
+	Nether Dimension = iota - 1
 	Overworld
 	Sky
 )
+
+// Number of Overworld blocks each block in the Nether corresponds to
+const netherScale = 8
+
+// Converts horizontal coordinates between dimensions when traveling through a
+// portal. Each block in the Nether corresponds to 8 in the other dimensions.
+func PortalCoordinates(x, z float64, from, to Dimension) (float64, float64) {
+	if from == Nether && to != Nether {
+		return x * netherScale, z * netherScale
+	}
+	if from != Nether && to == Nether {
+		return x / netherScale, z / netherScale
+	}
+	return x, z
+}
@@ -1,11 +1,16 @@
 package oneworld
 
+import "math"
+
 type EntityBase struct {
 	id int32
 
 	x float64
 	y float64
 	z float64
+
+	yaw   float32
+	pitch float32
 }
 
 func (entity *EntityBase) Id() int32 {
@@ -16,12 +21,46 @@ func (entity *EntityBase) Pos() (float64, float64, float64) {
 	return entity.x, entity.y, entity.z
 }
 
-func (*EntityBase) OnSpawned() {}
-func (*EntityBase) Tick()      {}
+func (entity *EntityBase) Angle() (float32, float32) {
+	return entity.yaw, entity.pitch
+}
+
+func (*EntityBase) OnSpawned()                    {}
+func (*EntityBase) Tick()                         {}
+func (*EntityBase) showTo(observer chunkObserver) {}
 
 type Entity interface {
 	Id() int32
 	Pos() (float64, float64, float64)
+	// Yaw and pitch in degrees
+	Angle() (float32, float32)
 	OnSpawned()
 	Tick()
+	// Sends the packets needed for the observer to see the entity. Entities
+	// that don't override this are invisible.
+	showTo(observer chunkObserver)
+}
+
+// Entities that have health and can be hurt
+type Damageable interface {
+	Entity
+	// Knockback is the velocity in blocks per tick the entity is pushed with
+	Damage(amount int16, knockbackX, knockbackY, knockbackZ float64)
+}
+
+// Converts a coordinate to the fixed-point representation used in entity
+// packets
+func absoluteInt(coord float64) int32 {
+	return int32(math.Floor(coord * 32))
+}
+
+// Converts an angle in degrees to a fraction of a full turn out of 256
+func packedAngle(degrees float32) byte {
+	return byte(int(degrees * 256 / 360))
+}
+
+// Converts a velocity in blocks per tick to the representation used in entity
+// packets. The client can't handle speeds above 3.9.
+func packedVelocity(velocity float64) int16 {
+	return int16(math.Max(-3.9, math.Min(velocity, 3.9)) * 8000)
 }
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
 	"github.com/richgrov/oneworld"
 	"github.com/richgrov/oneworld/blocks"
 )
 
+const maxPlayers = 20
+
 type player struct {
 	oneworld.PlayerBase[*oneworld.Server]
 }
@@ -12,14 +20,25 @@ type player struct {
 func (*player) OnChat(string) {}
 
 func (player *player) OnDig(x, y, z int, finishedDestroying bool) {
-	block := player.Server.GetBlock(x, y, z)
-	if finishedDestroying || block.Hardness() == blocks.InstaBreak {
+	if finishedDestroying {
 		player.Server.SetBlock(x, y, z, blocks.Block{})
 	}
 }
 
-func (*player) OnInteractBlock(x, y, z, x1, y1, z1 int) {}
-func (*player) OnInteractAir()                          {}
+func (player *player) OnInteractBlock(x, y, z, x1, y1, z1 int) {
+	player.PlaceHeldItem(x, y, z, x1, y1, z1)
+}
+
+func (*player) OnInteractAir()                 {}
+func (*player) OnHotbarChange(byte)            {}
+func (*player) OnSneak(bool)                   {}
+func (*player) OnSwingArm()                    {}
+func (*player) OnLeaveBed()                    {}
+func (*player) OnViolation(oneworld.Violation) {}
+
+func (player *player) OnError(err error) {
+	fmt.Printf("%s: %s\n", player.Username, err)
+}
 
 func createPlayer(baseEntity *oneworld.EntityBase, conn *oneworld.AcceptedConnection, server *oneworld.Server) *player {
 	player := new(player)
@@ -37,13 +56,79 @@ func createPlayer(baseEntity *oneworld.EntityBase, conn *oneworld.AcceptedConnec
 }
 
 func main() {
+	overworld := newFlatWorld(blocks.Stone)
+	nether := newFlatWorld(blocks.Netherrack)
+	universe, err := oneworld.NewUniverse(map[oneworld.Dimension]*oneworld.Server{
+		oneworld.Overworld: overworld,
+		oneworld.Nether:    nether,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := overworld.SetLevelFile("level.dat"); err != nil {
+		panic(err)
+	}
+	universe.SetPlayerDataDir("players")
+
 	listener, err := oneworld.NewListener("localhost:25565")
 	if err != nil {
 		panic(err)
 	}
+	listener.SetStatusFunc(func() oneworld.ServerStatus {
+		return oneworld.ServerStatus{
+			Motd:          "A oneworld server",
+			OnlinePlayers: universe.OnlinePlayers(),
+			MaxPlayers:    maxPlayers,
+		}
+	})
+
+	bannedNames, err := oneworld.LoadNameList("banned-players.txt")
+	if err != nil {
+		panic(err)
+	}
+	bannedIPs, err := oneworld.LoadIPList("banned-ips.txt")
+	if err != nil {
+		panic(err)
+	}
+	listener.SetLoginFilter(oneworld.LoginFilters(
+		oneworld.BannedNames(bannedNames),
+		oneworld.BannedIPs(bannedIPs),
+		oneworld.MaxPlayers(maxPlayers, universe.OnlinePlayers),
+	))
+
+	universe.SetListener(listener)
 	go listener.Run()
-	defer listener.Close()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+tickLoop:
+	for {
+		select {
+		case <-overworld.Ticker():
+		case <-ctx.Done():
+			break tickLoop
+		}
+
+		if conn := listener.Dequeue(); conn != nil {
+			base := overworld.AllocateEntity(0, 30, 0)
+			player := createPlayer(&base, conn, overworld)
+			// The player may have been moved to the world they were last in
+			player.Server.AddEntity(player)
+		}
+
+		universe.Tick()
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := universe.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("failed to shut down: %s\n", err)
+	}
+}
+
+func newFlatWorld(floor blocks.BlockType) *oneworld.Server {
 	chunks := make([]*oneworld.Chunk, 16*16)
 	for i := 0; i < len(chunks); i++ {
 		chunk := new(oneworld.Chunk)
@@ -51,7 +136,7 @@ func main() {
 		for x := 0; x < 16; x++ {
 			for z := 0; z < 16; z++ {
 				chunk.Set(x, 10, z, blocks.Block{
-					Type: blocks.Stone,
+					Type: floor,
 				})
 
 				for y := 0; y < 128; y++ {
@@ -67,14 +152,5 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer server.Shutdown()
-
-	for range server.Ticker() {
-		if conn := listener.Dequeue(); conn != nil {
-			base := server.AllocateEntity(0, 30, 0)
-			server.AddEntity(createPlayer(&base, conn, server))
-		}
-
-		server.Tick()
-	}
+	return server
 }
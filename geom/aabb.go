@@ -0,0 +1,188 @@
+package geom
+
+import "math"
+
+// An axis-aligned bounding box. Min must be less than or equal to Max on every
+// axis.
+type AABB struct {
+	Min Vec3
+	Max Vec3
+}
+
+func NewAABB(minX, minY, minZ, maxX, maxY, maxZ float64) AABB {
+	return AABB{
+		Min: Vec3{minX, minY, minZ},
+		Max: Vec3{maxX, maxY, maxZ},
+	}
+}
+
+// Creates a box with the given width and height whose bottom face is centered
+// on the position. This is how entity hitboxes are positioned.
+func EntityAABB(pos Vec3, width, height float64) AABB {
+	halfWidth := width / 2
+	return NewAABB(
+		pos.X-halfWidth, pos.Y, pos.Z-halfWidth,
+		pos.X+halfWidth, pos.Y+height, pos.Z+halfWidth,
+	)
+}
+
+func (box AABB) Offset(offset Vec3) AABB {
+	return AABB{box.Min.Add(offset), box.Max.Add(offset)}
+}
+
+// Grows the box by the amount in every direction
+func (box AABB) Grow(amount float64) AABB {
+	return NewAABB(
+		box.Min.X-amount, box.Min.Y-amount, box.Min.Z-amount,
+		box.Max.X+amount, box.Max.Y+amount, box.Max.Z+amount,
+	)
+}
+
+// Extends the box in the direction of the vector, resulting in a box that
+// covers everything it passes through when moved by the vector
+func (box AABB) Expand(vec Vec3) AABB {
+	expanded := box
+	if vec.X < 0 {
+		expanded.Min.X += vec.X
+	} else {
+		expanded.Max.X += vec.X
+	}
+
+	if vec.Y < 0 {
+		expanded.Min.Y += vec.Y
+	} else {
+		expanded.Max.Y += vec.Y
+	}
+
+	if vec.Z < 0 {
+		expanded.Min.Z += vec.Z
+	} else {
+		expanded.Max.Z += vec.Z
+	}
+	return expanded
+}
+
+// Whether the boxes overlap. Boxes that only touch don't intersect.
+func (box AABB) Intersects(other AABB) bool {
+	return box.Min.X < other.Max.X && box.Max.X > other.Min.X &&
+		box.Min.Y < other.Max.Y && box.Max.Y > other.Min.Y &&
+		box.Min.Z < other.Max.Z && box.Max.Z > other.Min.Z
+}
+
+// Whether the point is inside the box or on its surface
+func (box AABB) Contains(point Vec3) bool {
+	return point.X >= box.Min.X && point.X <= box.Max.X &&
+		point.Y >= box.Min.Y && point.Y <= box.Max.Y &&
+		point.Z >= box.Min.Z && point.Z <= box.Max.Z
+}
+
+func (box AABB) Center() Vec3 {
+	return box.Min.Add(box.Max).Scale(0.5)
+}
+
+// Returns the distance along the ray at which it enters the box, and the face
+// it enters through. Rays starting inside the box hit it at distance 0, in
+// which case the face is meaningless. Hits further than maxDistance are
+// ignored.
+func (box AABB) IntersectRay(ray Ray, maxDistance float64) (float64, Face, bool) {
+	near := 0.
+	far := maxDistance
+	face := FaceBottom
+
+	axes := [...]struct {
+		origin, direction, min, max float64
+		minFace, maxFace            Face
+	}{
+		{ray.Origin.X, ray.Direction.X, box.Min.X, box.Max.X, FaceNegativeX, FacePositiveX},
+		{ray.Origin.Y, ray.Direction.Y, box.Min.Y, box.Max.Y, FaceBottom, FaceTop},
+		{ray.Origin.Z, ray.Direction.Z, box.Min.Z, box.Max.Z, FaceNegativeZ, FacePositiveZ},
+	}
+
+	for _, axis := range axes {
+		if axis.direction == 0 {
+			if axis.origin < axis.min || axis.origin > axis.max {
+				return 0, 0, false
+			}
+			continue
+		}
+
+		enter := (axis.min - axis.origin) / axis.direction
+		exit := (axis.max - axis.origin) / axis.direction
+		enterFace := axis.minFace
+		if enter > exit {
+			enter, exit = exit, enter
+			enterFace = axis.maxFace
+		}
+
+		if enter > near {
+			near = enter
+			face = enterFace
+		}
+		far = math.Min(far, exit)
+
+		if near > far {
+			return 0, 0, false
+		}
+	}
+
+	return near, face, true
+}
+
+// Returns how far the box can move along the vector before colliding with any
+// of the obstacles. Movement is resolved one axis at a time, starting with Y,
+// so a box moving diagonally into a wall will slide along it.
+func (box AABB) Sweep(movement Vec3, obstacles []AABB) Vec3 {
+	for _, obstacle := range obstacles {
+		movement.Y = clipY(box, obstacle, movement.Y)
+	}
+	box = box.Offset(Vec3{0, movement.Y, 0})
+
+	for _, obstacle := range obstacles {
+		movement.X = clipX(box, obstacle, movement.X)
+	}
+	box = box.Offset(Vec3{movement.X, 0, 0})
+
+	for _, obstacle := range obstacles {
+		movement.Z = clipZ(box, obstacle, movement.Z)
+	}
+
+	return movement
+}
+
+// Limits movement along an axis so that box doesn't move into obstacle. The
+// boxes must overlap on the other two axes for there to be a collision.
+func clipAxis(boxMin, boxMax, obstacleMin, obstacleMax, movement float64) float64 {
+	if movement > 0 && boxMax <= obstacleMin {
+		return math.Min(movement, obstacleMin-boxMax)
+	}
+
+	if movement < 0 && boxMin >= obstacleMax {
+		return math.Max(movement, obstacleMax-boxMin)
+	}
+
+	return movement
+}
+
+func clipX(box, obstacle AABB, movement float64) float64 {
+	if box.Max.Y <= obstacle.Min.Y || box.Min.Y >= obstacle.Max.Y ||
+		box.Max.Z <= obstacle.Min.Z || box.Min.Z >= obstacle.Max.Z {
+		return movement
+	}
+	return clipAxis(box.Min.X, box.Max.X, obstacle.Min.X, obstacle.Max.X, movement)
+}
+
+func clipY(box, obstacle AABB, movement float64) float64 {
+	if box.Max.X <= obstacle.Min.X || box.Min.X >= obstacle.Max.X ||
+		box.Max.Z <= obstacle.Min.Z || box.Min.Z >= obstacle.Max.Z {
+		return movement
+	}
+	return clipAxis(box.Min.Y, box.Max.Y, obstacle.Min.Y, obstacle.Max.Y, movement)
+}
+
+func clipZ(box, obstacle AABB, movement float64) float64 {
+	if box.Max.X <= obstacle.Min.X || box.Min.X >= obstacle.Max.X ||
+		box.Max.Y <= obstacle.Min.Y || box.Min.Y >= obstacle.Max.Y {
+		return movement
+	}
+	return clipAxis(box.Min.Z, box.Max.Z, obstacle.Min.Z, obstacle.Max.Z, movement)
+}
@@ -0,0 +1,80 @@
+package geom_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/richgrov/oneworld/geom"
+)
+
+const epsilon = 1e-9
+
+func vecEqual(a, b geom.Vec3) bool {
+	return math.Abs(a.X-b.X) < epsilon && math.Abs(a.Y-b.Y) < epsilon && math.Abs(a.Z-b.Z) < epsilon
+}
+
+func TestIntersectRay(t *testing.T) {
+	box := geom.NewAABB(0, 0, 0, 1, 1, 1)
+
+	tests := []struct {
+		ray      geom.Ray
+		hit      bool
+		distance float64
+		face     geom.Face
+	}{
+		{geom.Ray{geom.Vec3{-1, 0.5, 0.5}, geom.Vec3{1, 0, 0}}, true, 1, geom.FaceNegativeX},
+		{geom.Ray{geom.Vec3{2, 0.5, 0.5}, geom.Vec3{-2, 0, 0}}, true, 0.5, geom.FacePositiveX},
+		{geom.Ray{geom.Vec3{0.5, 3, 0.5}, geom.Vec3{0, -1, 0}}, true, 2, geom.FaceTop},
+		{geom.Ray{geom.Vec3{0.5, 0.5, -1}, geom.Vec3{0, 0, 1}}, true, 1, geom.FaceNegativeZ},
+		{geom.Ray{geom.Vec3{0.5, 0.5, 0.5}, geom.Vec3{1, 0, 0}}, true, 0, geom.FaceBottom},
+		{geom.Ray{geom.Vec3{-1, 2, 0.5}, geom.Vec3{1, 0, 0}}, false, 0, 0},
+		{geom.Ray{geom.Vec3{-1, 0.5, 0.5}, geom.Vec3{-1, 0, 0}}, false, 0, 0},
+		// Stops short of the box
+		{geom.Ray{geom.Vec3{-5, 0.5, 0.5}, geom.Vec3{1, 0, 0}}, false, 0, 0},
+	}
+
+	for _, test := range tests {
+		distance, face, hit := box.IntersectRay(test.ray, 3)
+		if hit != test.hit || (hit && (math.Abs(distance-test.distance) > epsilon || face != test.face)) {
+			t.Errorf("ray %v: expected (%v, %f, %d) but got (%v, %f, %d)", test.ray, test.hit, test.distance, test.face, hit, distance, face)
+		}
+	}
+}
+
+func TestSweepLandsOnFloor(t *testing.T) {
+	floor := []geom.AABB{geom.NewAABB(-5, 0, -5, 5, 1, 5)}
+	box := geom.EntityAABB(geom.Vec3{0, 3, 0}, 0.6, 1.8)
+
+	movement := box.Sweep(geom.Vec3{0.5, -5, 0}, floor)
+	if !vecEqual(movement, geom.Vec3{0.5, -2, 0}) {
+		t.Fatalf("expected box to land on floor but moved %v", movement)
+	}
+}
+
+func TestSweepSlidesAlongWall(t *testing.T) {
+	wall := []geom.AABB{geom.NewAABB(1, 0, -5, 2, 2, 5)}
+	box := geom.EntityAABB(geom.Vec3{0, 0, 0}, 0.6, 1.8)
+
+	movement := box.Sweep(geom.Vec3{1, 0, 1}, wall)
+	if !vecEqual(movement, geom.Vec3{0.7, 0, 1}) {
+		t.Fatalf("expected box to slide along wall but moved %v", movement)
+	}
+}
+
+func TestSweepIgnoresOverlapping(t *testing.T) {
+	// Boxes that are already intersecting shouldn't trap each other
+	obstacle := []geom.AABB{geom.NewAABB(0, 0, 0, 1, 1, 1)}
+	box := geom.NewAABB(0.5, 0.5, 0.5, 1.5, 1.5, 1.5)
+
+	movement := box.Sweep(geom.Vec3{1, 0, 0}, obstacle)
+	if !vecEqual(movement, geom.Vec3{1, 0, 0}) {
+		t.Fatalf("expected box to move freely but moved %v", movement)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	box := geom.NewAABB(0, 0, 0, 1, 1, 1).Expand(geom.Vec3{-1, 2, 0})
+	if box != geom.NewAABB(-1, 0, 0, 1, 3, 1) {
+		t.Fatalf("unexpected expanded box %v", box)
+	}
+}
@@ -0,0 +1,43 @@
+package geom
+
+// Sides of a box, in the same order as the block faces used by the protocol
+type Face byte
+
+const (
+	FaceBottom Face = iota
+	FaceTop
+	FaceNegativeZ
+	FacePositiveZ
+	FaceNegativeX
+	FacePositiveX
+)
+
+// Returns the unit vector pointing out of the face
+func (face Face) Normal() Vec3 {
+	switch face {
+	case FaceBottom:
+		return Vec3{Y: -1}
+	case FaceTop:
+		return Vec3{Y: 1}
+	case FaceNegativeZ:
+		return Vec3{Z: -1}
+	case FacePositiveZ:
+		return Vec3{Z: 1}
+	case FaceNegativeX:
+		return Vec3{X: -1}
+	default:
+		return Vec3{X: 1}
+	}
+}
+
+// Distances along a ray are measured in multiples of Direction, so a ray with
+// a non-normalized direction can be used to represent a segment from Origin to
+// Origin+Direction with distances from 0 to 1.
+type Ray struct {
+	Origin    Vec3
+	Direction Vec3
+}
+
+func (ray Ray) At(distance float64) Vec3 {
+	return ray.Origin.Add(ray.Direction.Scale(distance))
+}
@@ -0,0 +1,43 @@
+package geom
+
+import "math"
+
+type Vec3 struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+func (vec Vec3) Add(other Vec3) Vec3 {
+	return Vec3{vec.X + other.X, vec.Y + other.Y, vec.Z + other.Z}
+}
+
+func (vec Vec3) Sub(other Vec3) Vec3 {
+	return Vec3{vec.X - other.X, vec.Y - other.Y, vec.Z - other.Z}
+}
+
+func (vec Vec3) Scale(factor float64) Vec3 {
+	return Vec3{vec.X * factor, vec.Y * factor, vec.Z * factor}
+}
+
+func (vec Vec3) Dot(other Vec3) float64 {
+	return vec.X*other.X + vec.Y*other.Y + vec.Z*other.Z
+}
+
+func (vec Vec3) LengthSq() float64 {
+	return vec.Dot(vec)
+}
+
+func (vec Vec3) Length() float64 {
+	return math.Sqrt(vec.LengthSq())
+}
+
+// Returns a vector with the same direction and a length of 1. The zero vector
+// is returned unchanged.
+func (vec Vec3) Normalize() Vec3 {
+	length := vec.Length()
+	if length == 0 {
+		return vec
+	}
+	return vec.Scale(1 / length)
+}
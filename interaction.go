@@ -0,0 +1,85 @@
+package oneworld
+
+import (
+	"github.com/richgrov/oneworld/geom"
+)
+
+// Limits on which blocks players may dig or interact with. Setting a field to
+// its zero value disables the check.
+type InteractionChecks struct {
+	// Maximum distance from the player's eyes to the center of the block
+	Reach float64
+	// Whether to prevent interactions with blocks that are hidden behind
+	// other blocks
+	CheckLineOfSight bool
+}
+
+var DefaultInteractionChecks = InteractionChecks{
+	Reach:            6,
+	CheckLineOfSight: false,
+}
+
+// How far from the edges of a face the points tested for line of sight are
+const faceSampleInset = 0.1
+
+func (player *PlayerBase[S]) SetInteractionChecks(checks InteractionChecks) {
+	player.interactionChecks = checks
+}
+
+func (player *PlayerBase[S]) eyePos() geom.Vec3 {
+	return geom.Vec3{X: player.x, Y: player.y + playerEyeHeight, Z: player.z}
+}
+
+// Returns whether the player is able to interact with the face of the block.
+// If not, a violation is reported.
+func (player *PlayerBase[S]) canInteract(x, y, z int, face geom.Face) bool {
+	checks := &player.interactionChecks
+	eyes := player.eyePos()
+	center := geom.Vec3{X: float64(x) + 0.5, Y: float64(y) + 0.5, Z: float64(z) + 0.5}
+
+	if checks.Reach > 0 && center.Sub(eyes).LengthSq() > checks.Reach*checks.Reach {
+		player.eventHandler.OnViolation(ViolationReach)
+		return false
+	}
+
+	if checks.CheckLineOfSight && !player.canSeeFace(BlockPos{x, y, z}, face) {
+		player.eventHandler.OnViolation(ViolationLineOfSight)
+		return false
+	}
+
+	return true
+}
+
+// Whether the center or any corner of the face is visible from the player's
+// eyes. Testing several points avoids rejecting faces that are only partly
+// hidden.
+func (player *PlayerBase[S]) canSeeFace(pos BlockPos, face geom.Face) bool {
+	normal := face.Normal()
+	// Two directions along the surface of the face
+	u := geom.Vec3{X: normal.Y, Y: normal.Z, Z: normal.X}
+	v := geom.Vec3{X: normal.Z, Y: normal.X, Z: normal.Y}
+
+	center := geom.Vec3{X: float64(pos.X) + 0.5, Y: float64(pos.Y) + 0.5, Z: float64(pos.Z) + 0.5}.
+		Add(normal.Scale(0.5))
+	offset := 0.5 - faceSampleInset
+
+	points := [...]geom.Vec3{
+		center,
+		center.Add(u.Scale(offset)).Add(v.Scale(offset)),
+		center.Add(u.Scale(offset)).Add(v.Scale(-offset)),
+		center.Add(u.Scale(-offset)).Add(v.Scale(offset)),
+		center.Add(u.Scale(-offset)).Add(v.Scale(-offset)),
+	}
+
+	eyes := player.eyePos()
+	for _, point := range points {
+		ray := geom.Ray{Origin: eyes, Direction: point.Sub(eyes)}
+		hitPos, distance, _, hit := player.Server.RaycastBlocks(ray, 1)
+		// The ray may touch a neighboring block right at the point
+		if !hit || hitPos == pos || distance > 1-1e-6 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package oneworld
+
+import (
+	"testing"
+
+	"github.com/richgrov/oneworld/geom"
+)
+
+func TestInteractionReach(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+	player.SetInteractionChecks(DefaultInteractionChecks)
+
+	if !player.canInteract(8, movementFloorY, 10, geom.FaceTop) {
+		t.Fatalf("couldn't reach nearby block: %v", recorder.violations)
+	}
+
+	if player.canInteract(8, movementFloorY, 15, geom.FaceTop) {
+		t.Fatal("reached block 6.5 blocks away")
+	}
+	expectViolation(t, recorder, ViolationReach)
+}
+
+func TestInteractionLineOfSight(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+	player.SetInteractionChecks(InteractionChecks{Reach: 6, CheckLineOfSight: true})
+
+	if !player.canInteract(10, movementFloorY+1, 8, geom.FaceNegativeX) {
+		t.Fatalf("couldn't see face of wall: %v", recorder.violations)
+	}
+
+	if !player.canInteract(9, movementFloorY, 8, geom.FaceTop) {
+		t.Fatalf("couldn't see floor: %v", recorder.violations)
+	}
+
+	// Behind the wall
+	if player.canInteract(11, movementFloorY+1, 8, geom.FaceNegativeX) {
+		t.Fatal("interacted with block behind wall")
+	}
+	expectViolation(t, recorder, ViolationLineOfSight)
+}
@@ -0,0 +1,349 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Raw bytes sent by Beta 1.7.3 clients to a server, one session per .bin file.
+// Every file is replayed into the fuzz corpora alongside clientSession.
+const capturesDir = "testdata/captures"
+
+// Packets a Beta 1.7.3 client sends when joining a server, moving around,
+// interacting with the world and leaving. These were written by hand from the
+// protocol and are not recorded traffic. They stay until sessions captured
+// from a real client are added to capturesDir.
+var clientSession = [][]byte{
+	// Handshake "Notch"
+	{HandshakeId, 0, 5, 0, 'N', 0, 'o', 0, 't', 0, 'c', 0, 'h'},
+	// Login with protocol 14. The seed and dimension are unused.
+	{LoginId, 0, 0, 0, 14, 0, 5, 0, 'N', 0, 'o', 0, 't', 0, 'c', 0, 'h', 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	// Confirms the spawn position
+	{
+		SetAngleAndPositionId,
+		0x40, 0x20, 0, 0, 0, 0, 0, 0, // 8
+		0x40, 0x51, 0x80, 0, 0, 0, 0, 0, // 70
+		0x40, 0x51, 0xE7, 0xAE, 0x14, 0x7A, 0xE1, 0x48, // 71.62
+		0x40, 0x20, 0, 0, 0, 0, 0, 0, // 8
+		0, 0, 0, 0,
+		0, 0, 0, 0,
+		0,
+	},
+	{KeepAliveId},
+	{SetOnGroundId, 1},
+	{
+		SetPositionId,
+		0x40, 0x20, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, // 8.2
+		0x40, 0x51, 0x80, 0, 0, 0, 0, 0, // 70
+		0x40, 0x51, 0xE7, 0xAE, 0x14, 0x7A, 0xE1, 0x48, // 71.62
+		0x40, 0x20, 0, 0, 0, 0, 0, 0, // 8
+		1,
+	},
+	{SetAngleId, 0x43, 0x34, 0, 0, 0xC1, 0xF0, 0, 0, 1}, // 180, -30
+	// Chat "hello"
+	{ChatId, 0, 5, 0, 'h', 0, 'e', 0, 'l', 0, 'l', 0, 'o'},
+	{AnimationId, 0, 0, 0, 1, AnimationSwingArm},
+	// Mines the block at 8, 69, 8 from above
+	{DigId, DigStarted, 0, 0, 0, 8, 69, 0, 0, 0, 8, 1},
+	{DigId, DigFinished, 0, 0, 0, 8, 69, 0, 0, 0, 8, 1},
+	// Places a dirt block, then uses an empty hand on air
+	{UseItemId, 0, 0, 0, 8, 69, 0, 0, 0, 8, 1, 0, 3, 64, 0, 0},
+	{UseItemId, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+	{SetHotbarSelectionId, 0, 3},
+	{EntityActionId, 0, 0, 0, 1, byte(ActionStartSneak)},
+	{EntityActionId, 0, 0, 0, 1, byte(ActionStopSneak)},
+	// Moves a stack of dirt in the inventory, then clicks an empty slot
+	{InventoryClickId, 0, 0, 36, 0, 0, 1, 0, 0, 3, 64, 0, 0},
+	{InventoryClickId, 0, 0, 9, 0, 0, 2, 0, 0xFF, 0xFF},
+	{CloseInventoryId, 0},
+	{RespawnId, 0},
+	// Disconnect "Quitting"
+	{DisconnectId, 0, 8, 0, 'Q', 0, 'u', 0, 'i', 0, 't', 0, 't', 0, 'i', 0, 'n', 0, 'g'},
+}
+
+func TestClientSession(t *testing.T) {
+	reader := newTestReader(bytes.Join(clientSession, nil))
+	for _, packet := range clientSession {
+		if _, err := ReadNextPacket(reader); err != nil {
+			t.Fatalf("failed to decode %v: %v", packet, err)
+		}
+	}
+	if reader.Buffered() > 0 {
+		t.Fatalf("%d bytes left over", reader.Buffered())
+	}
+}
+
+// Reads every captured session in capturesDir
+func capturedSessions(tb testing.TB) [][]byte {
+	paths, err := filepath.Glob(filepath.Join(capturesDir, "*.bin"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	sessions := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		sessions = append(sessions, data)
+	}
+	return sessions
+}
+
+// Splits a session into its packets. Returns an error if the session doesn't
+// decode completely.
+func splitPackets(session []byte) ([][]byte, error) {
+	source := bytes.NewReader(session)
+	reader := bufio.NewReader(source)
+
+	var packets [][]byte
+	start := 0
+	for start < len(session) {
+		if _, err := ReadNextPacket(reader); err != nil {
+			return nil, err
+		}
+		end := len(session) - source.Len() - reader.Buffered()
+		packets = append(packets, session[start:end])
+		start = end
+	}
+	return packets, nil
+}
+
+// Returns the packets of the client session and of every captured session
+func seedPackets(f *testing.F) [][]byte {
+	packets := append([][]byte{}, clientSession...)
+	for _, session := range capturedSessions(f) {
+		split, err := splitPackets(session)
+		if err != nil {
+			f.Fatal(err)
+		}
+		packets = append(packets, split...)
+	}
+	return packets
+}
+
+func TestCapturedSessions(t *testing.T) {
+	sessions := capturedSessions(t)
+	if len(sessions) == 0 {
+		t.Skip("no sessions have been captured")
+	}
+
+	for i, session := range sessions {
+		if _, err := splitPackets(session); err != nil {
+			t.Errorf("session %d: %v", i, err)
+		}
+	}
+}
+
+// Adds every seed packet with the ID to the corpus without its ID
+func addPayloads(f *testing.F, packetId byte) {
+	for _, packet := range seedPackets(f) {
+		if packet[0] == packetId {
+			f.Add(packet[1:])
+		}
+	}
+}
+
+func FuzzReadNextPacket(f *testing.F) {
+	f.Add(bytes.Join(clientSession, nil))
+	for _, session := range capturedSessions(f) {
+		f.Add(session)
+	}
+	for _, packet := range seedPackets(f) {
+		f.Add(packet)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := newTestReader(data)
+		for {
+			if _, err := ReadNextPacket(reader); err != nil {
+				break
+			}
+		}
+	})
+}
+
+// Checks that decoding arbitrary payloads never panics
+func fuzzUnmarshal[P InboundPacket[P]](f *testing.F, packetId byte, newPacket func() P) {
+	addPayloads(f, packetId)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		newPacket().Unmarshal(newTestReader(data))
+	})
+}
+
+func FuzzKeepAliveUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, KeepAliveId, func() *KeepAlivePacket { return new(KeepAlivePacket) })
+}
+
+func FuzzLoginUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, LoginId, func() *LoginPacket { return new(LoginPacket) })
+}
+
+func FuzzHandshakeUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, HandshakeId, func() *HandshakePacket { return new(HandshakePacket) })
+}
+
+func FuzzChatUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, ChatId, func() *ChatPacket { return new(ChatPacket) })
+}
+
+func FuzzRespawnUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, RespawnId, func() *RespawnPacket { return new(RespawnPacket) })
+}
+
+func FuzzSetOnGroundUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, SetOnGroundId, func() *SetOnGroundPacket { return new(SetOnGroundPacket) })
+}
+
+func FuzzSetPositionUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, SetPositionId, func() *SetPositionPacket { return new(SetPositionPacket) })
+}
+
+func FuzzSetAngleUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, SetAngleId, func() *SetAnglePacket { return new(SetAnglePacket) })
+}
+
+func FuzzSetAngleAndPositionUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, SetAngleAndPositionId, func() *SetAngleAndPositionPacket { return new(SetAngleAndPositionPacket) })
+}
+
+func FuzzDigUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, DigId, func() *DigPacket { return new(DigPacket) })
+}
+
+func FuzzUseItemUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, UseItemId, func() *UseItemPacket { return new(UseItemPacket) })
+}
+
+func FuzzSetHotbarSelectionUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, SetHotbarSelectionId, func() *SetHotbarSelectionPacket { return new(SetHotbarSelectionPacket) })
+}
+
+func FuzzAnimationUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, AnimationId, func() *AnimationPacket { return new(AnimationPacket) })
+}
+
+func FuzzEntityActionUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, EntityActionId, func() *EntityActionPacket { return new(EntityActionPacket) })
+}
+
+func FuzzEntityMetadataUnmarshal(f *testing.F) {
+	// Not sent by clients, so the seeds are built instead
+	f.Add((&EntityMetadataPacket{EntityId: 1, Metadata: Metadata{
+		{Index: MetadataFlags, Value: FlagOnFire | FlagCrouched},
+		{Index: 8, Value: "tag"},
+		{Index: 9, Value: MetadataItemStack{ItemId: 1, Count: 64}},
+		{Index: 10, Value: MetadataPosition{X: 1, Y: 2, Z: 3}},
+	}}).Marshal()[1:])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		new(EntityMetadataPacket).Unmarshal(newTestReader(data))
+	})
+}
+
+func FuzzCloseInventoryUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, CloseInventoryId, func() *CloseInventoryPacket { return new(CloseInventoryPacket) })
+}
+
+func FuzzInventoryClickUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, InventoryClickId, func() *InventoryClickPacket { return new(InventoryClickPacket) })
+}
+
+func FuzzDisconnectUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, DisconnectId, func() *DisconnectPacket { return new(DisconnectPacket) })
+}
+
+// Marshals the packet, unmarshals the result and checks that it equals the
+// expected packet, or that decoding fails if the packet can't be encoded
+func checkRoundTrip[P interface {
+	OutboundPacket
+	InboundPacket[P]
+}](t *testing.T, packet P, decoded P, expected P, valid bool) {
+	t.Helper()
+
+	data := packet.Marshal()
+	reader := newTestReader(data[1:])
+	_, err := decoded.Unmarshal(reader)
+
+	if !valid {
+		if !errors.Is(err, ErrInvalidString) {
+			t.Fatalf("expected ErrInvalidString decoding %+v but got %v", packet, err)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("failed to decode %+v: %v", packet, err)
+	}
+	if reader.Buffered() > 0 {
+		t.Fatalf("%d bytes left over after decoding %+v", reader.Buffered(), packet)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, decoded)
+	}
+}
+
+// Strings are encoded as UTF-16, so invalid UTF-8 is replaced with U+FFFD. The
+// encoded string is valid if its length is within the limit.
+func encodedString(str string, maxLen int) (string, bool) {
+	return string([]rune(str)), utf16Length(str) <= maxLen
+}
+
+func FuzzLoginRoundTrip(f *testing.F) {
+	f.Add(int32(14), "Notch", int64(0), byte(0))
+	f.Add(int32(-1), "jeb_🌍", int64(-4172144997902289642), byte(255))
+	f.Add(int32(14), "seventeen_chars__", int64(1), byte(1))
+
+	f.Fuzz(func(t *testing.T, version int32, username string, seed int64, dimension byte) {
+		expectedName, valid := encodedString(username, 16)
+		packet := &LoginPacket{ProtocolVersion: version, Username: username, MapSeed: seed, Dimension: dimension}
+		expected := &LoginPacket{ProtocolVersion: version, Username: expectedName, MapSeed: seed, Dimension: dimension}
+		checkRoundTrip(t, packet, new(LoginPacket), expected, valid)
+	})
+}
+
+func FuzzHandshakeRoundTrip(f *testing.F) {
+	f.Add("Notch")
+	f.Add("")
+	f.Add("\xff\xfe")
+
+	f.Fuzz(func(t *testing.T, username string) {
+		expectedName, valid := encodedString(username, 16)
+		checkRoundTrip(t, &HandshakePacket{Username: username}, new(HandshakePacket), &HandshakePacket{Username: expectedName}, valid)
+	})
+}
+
+func FuzzChatRoundTrip(f *testing.F) {
+	f.Add("hello")
+	f.Add("§ehéllo 🌍")
+	f.Add(string(make([]byte, 120)))
+
+	f.Fuzz(func(t *testing.T, message string) {
+		expectedMessage, valid := encodedString(message, 119)
+		checkRoundTrip(t, &ChatPacket{Message: message}, new(ChatPacket), &ChatPacket{Message: expectedMessage}, valid)
+	})
+}
+
+func FuzzSetPositionRoundTrip(f *testing.F) {
+	f.Add(8.2, 70.0, 71.62, 8.0, true)
+	f.Add(-1e9, 0.0, -0.0, 1e-300, false)
+
+	f.Fuzz(func(t *testing.T, x, y, stance, z float64, onGround bool) {
+		// NaN never equals itself, so it is compared by its bits instead
+		packet := &SetPositionPacket{X: x, Y: y, Stance: stance, Z: z, OnGround: onGround}
+		decoded := new(SetPositionPacket)
+		data := packet.Marshal()
+		if _, err := decoded.Unmarshal(newTestReader(data[1:])); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Marshal(), data) {
+			t.Fatalf("expected %+v but got %+v", packet, decoded)
+		}
+	})
+}
@@ -0,0 +1,292 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// The reflection based encoder packets were previously marshalled with. The
+// hand-written encoders must produce exactly the same bytes.
+func reflectMarshal(packetId byte, fields ...any) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	buf.WriteByte(packetId)
+
+	for _, field := range fields {
+		if metadata, ok := field.(Metadata); ok {
+			reflectWriteMetadata(buf, metadata)
+			continue
+		}
+
+		val := reflect.ValueOf(field)
+
+		switch val.Kind() {
+		case reflect.Bool:
+			if val.Bool() {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+
+		case reflect.Uint8:
+			buf.WriteByte(byte(val.Uint()))
+
+		case reflect.Int16:
+			binary.Write(buf, binary.BigEndian, int16(val.Int()))
+
+		case reflect.Int32:
+			binary.Write(buf, binary.BigEndian, int32(val.Int()))
+
+		case reflect.Int64:
+			binary.Write(buf, binary.BigEndian, val.Int())
+
+		case reflect.Float32:
+			binary.Write(buf, binary.BigEndian, float32(val.Float()))
+
+		case reflect.Float64:
+			binary.Write(buf, binary.BigEndian, val.Float())
+
+		case reflect.String:
+			reflectWriteString(buf, val.String())
+
+		case reflect.Slice:
+			slice := val.Interface().([]byte)
+			binary.Write(buf, binary.BigEndian, int32(len(slice)))
+			buf.Write(slice)
+
+		default:
+			panic("marshal: unsupported field type")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func reflectWriteString(writer io.Writer, str string) error {
+	data := utf16.Encode([]rune(str))
+
+	if err := binary.Write(writer, binary.BigEndian, int16(len(data))); err != nil {
+		return err
+	}
+
+	return binary.Write(writer, binary.BigEndian, data)
+}
+
+func reflectWriteMetadata(buf *bytes.Buffer, metadata Metadata) {
+	for _, entry := range metadata {
+		switch value := entry.Value.(type) {
+		case byte:
+			buf.WriteByte(metadataByte<<5 | entry.Index)
+			buf.WriteByte(value)
+
+		case int16:
+			buf.WriteByte(metadataShort<<5 | entry.Index)
+			binary.Write(buf, binary.BigEndian, value)
+
+		case int32:
+			buf.WriteByte(metadataInt<<5 | entry.Index)
+			binary.Write(buf, binary.BigEndian, value)
+
+		case float32:
+			buf.WriteByte(metadataFloat<<5 | entry.Index)
+			binary.Write(buf, binary.BigEndian, value)
+
+		case string:
+			buf.WriteByte(metadataString<<5 | entry.Index)
+			reflectWriteString(buf, value)
+
+		case MetadataItemStack:
+			buf.WriteByte(metadataItemStack<<5 | entry.Index)
+			binary.Write(buf, binary.BigEndian, value.ItemId)
+			buf.WriteByte(value.Count)
+			binary.Write(buf, binary.BigEndian, value.Damage)
+
+		case MetadataPosition:
+			buf.WriteByte(metadataPosition<<5 | entry.Index)
+			binary.Write(buf, binary.BigEndian, value.X)
+			binary.Write(buf, binary.BigEndian, value.Y)
+			binary.Write(buf, binary.BigEndian, value.Z)
+		}
+	}
+
+	buf.WriteByte(metadataEnd)
+}
+
+var marshalTests = []struct {
+	packet   OutboundPacket
+	expected []byte
+}{
+	{&KeepAlivePacket{}, reflectMarshal(KeepAliveId)},
+	{
+		&LoginPacket{ProtocolVersion: 14, Username: "Notch", MapSeed: -4172144997902289642, Dimension: 255},
+		reflectMarshal(LoginId, int32(14), "Notch", int64(-4172144997902289642), byte(255)),
+	},
+	{&HandshakePacket{Username: "-"}, reflectMarshal(HandshakeId, "-")},
+	{&HandshakePacket{}, reflectMarshal(HandshakeId, "")},
+	// Characters outside the BMP are encoded as surrogate pairs
+	{&ChatPacket{Message: "§ehéllo 🌍 \xff"}, reflectMarshal(ChatId, "§ehéllo 🌍 \xff")},
+	{&TimeUpdatePacket{Time: 123456789}, reflectMarshal(TimeUpdateId, int64(123456789))},
+	{
+		&EntityEquipmentPacket{EntityId: 7, Slot: EquipmentHelmet, ItemId: -1},
+		reflectMarshal(EntityEquipmentId, int32(7), EquipmentHelmet, int16(-1), int16(0)),
+	},
+	{&UpdateHealthPacket{Health: 20}, reflectMarshal(UpdateHealthId, int16(20))},
+	{&RespawnPacket{Dimension: 255}, reflectMarshal(RespawnId, byte(255))},
+	{
+		&SetPositionPacket{X: 1.5, Y: 64, Stance: 65.62, Z: -300.25, OnGround: true},
+		reflectMarshal(SetPositionId, 1.5, 64.0, 65.62, -300.25, true),
+	},
+	{&AnimationPacket{EntityId: 3, Animate: AnimationSwingArm}, reflectMarshal(AnimationId, int32(3), AnimationSwingArm)},
+	{
+		&NamedEntitySpawnPacket{EntityId: 9, Username: "jeb_", X: -32, Y: 2048, Z: 96, Yaw: 64, Pitch: 200, CurrentItem: 276},
+		reflectMarshal(NamedEntitySpawnId, int32(9), "jeb_", int32(-32), int32(2048), int32(96), byte(64), byte(200), int16(276)),
+	},
+	{
+		&AddObjectPacket{EntityId: 4, Type: ObjectArrow, X: 1, Y: 2, Z: 3, ThrowerId: 9, VelocityX: -100, VelocityY: 8000, VelocityZ: 1},
+		reflectMarshal(AddObjectId, int32(4), ObjectArrow, int32(1), int32(2), int32(3), int32(9), int16(-100), int16(8000), int16(1)),
+	},
+	{
+		&AddObjectPacket{EntityId: 4, Type: ObjectBoat, X: 1, Y: 2, Z: 3, VelocityX: 5},
+		reflectMarshal(AddObjectId, int32(4), ObjectBoat, int32(1), int32(2), int32(3), int32(0)),
+	},
+	{
+		&EntityVelocityPacket{EntityId: 2, VelocityX: 1, VelocityY: -2, VelocityZ: 3},
+		reflectMarshal(EntityVelocityId, int32(2), int16(1), int16(-2), int16(3)),
+	},
+	{&DestroyEntityPacket{EntityId: 12}, reflectMarshal(DestroyEntityId, int32(12))},
+	{
+		&EntityTeleportPacket{EntityId: 5, X: 320, Y: -1, Z: 640, Yaw: 1, Pitch: 255},
+		reflectMarshal(EntityTeleportId, int32(5), int32(320), int32(-1), int32(640), byte(1), byte(255)),
+	},
+	{
+		&EntityMetadataPacket{EntityId: 6, Metadata: Metadata{
+			{Index: MetadataFlags, Value: FlagCrouched},
+			{Index: 1, Value: int16(300)},
+			{Index: 2, Value: int32(-5)},
+			{Index: 3, Value: float32(0.5)},
+			{Index: 4, Value: "tag"},
+			{Index: 5, Value: MetadataItemStack{ItemId: 1, Count: 64, Damage: 2}},
+			{Index: 6, Value: MetadataPosition{X: 1, Y: 2, Z: 3}},
+		}},
+		reflectMarshal(EntityMetadataId, int32(6), Metadata{
+			{Index: MetadataFlags, Value: FlagCrouched},
+			{Index: 1, Value: int16(300)},
+			{Index: 2, Value: int32(-5)},
+			{Index: 3, Value: float32(0.5)},
+			{Index: 4, Value: "tag"},
+			{Index: 5, Value: MetadataItemStack{ItemId: 1, Count: 64, Damage: 2}},
+			{Index: 6, Value: MetadataPosition{X: 1, Y: 2, Z: 3}},
+		}),
+	},
+	{&EntityMetadataPacket{EntityId: 6}, reflectMarshal(EntityMetadataId, int32(6), Metadata(nil))},
+	{&PreChunkPacket{ChunkX: -1, ChunkZ: 4, Load: true}, reflectMarshal(PreChunkId, int32(-1), int32(4), true)},
+	{
+		&ChunkDataPacket{StartX: -16, StartY: 0, StartZ: 32, XSize: 15, YSize: 127, ZSize: 15, Data: []byte{1, 2, 3, 4}},
+		reflectMarshal(ChunkDataId, int32(-16), int16(0), int32(32), byte(15), byte(127), byte(15), []byte{1, 2, 3, 4}),
+	},
+	{
+		&BlockChangePacket{X: -100, Y: 64, Z: 100, Type: 1, Data: 2},
+		reflectMarshal(BlockChangeId, int32(-100), byte(64), int32(100), byte(1), byte(2)),
+	},
+	{&NewStatePacket{Reason: StateBeginRain}, reflectMarshal(NewStateId, StateBeginRain)},
+	{
+		&ThunderboltPacket{EntityId: 8, X: 32, Y: 64, Z: -32},
+		reflectMarshal(ThunderboltId, int32(8), true, int32(32), int32(64), int32(-32)),
+	},
+	{
+		&SetSlotPacket{WindowId: 0, Slot: 36, ItemId: 1, StackSize: 64, Damage: 3},
+		reflectMarshal(SetSlotId, byte(0), int16(36), int16(1), byte(64), int16(3)),
+	},
+	{
+		&SetSlotPacket{WindowId: 0, Slot: 36, ItemId: -1, StackSize: 64},
+		reflectMarshal(SetSlotId, byte(0), int16(36), int16(-1)),
+	},
+	{&DisconnectPacket{Message: "Server closed"}, reflectMarshal(DisconnectId, "Server closed")},
+}
+
+func TestMarshal(t *testing.T) {
+	for _, test := range marshalTests {
+		t.Run(fmt.Sprintf("%T", test.packet), func(t *testing.T) {
+			actual := test.packet.Marshal()
+			if !bytes.Equal(actual, test.expected) {
+				t.Fatalf("expected %v but got %v", test.expected, actual)
+			}
+			if cap(actual) != len(actual) {
+				t.Errorf("allocated %d bytes for a %d byte packet", cap(actual), len(actual))
+			}
+		})
+	}
+}
+
+func TestAppendReusesBuffer(t *testing.T) {
+	var expected []byte
+	for _, test := range marshalTests {
+		expected = append(expected, test.expected...)
+	}
+
+	buf := make([]byte, 0, len(expected))
+	for _, test := range marshalTests {
+		buf = test.packet.Append(buf)
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Fatal("appended packets don't match their marshalled forms")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = buf[:0]
+		for _, test := range marshalTests {
+			buf = test.packet.Append(buf)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("appending to a large enough buffer allocated %v times", allocs)
+	}
+}
+
+// Keeps benchmarked results on the heap like packets queued for sending
+var marshalSink []byte
+
+func BenchmarkMarshalBlockChange(b *testing.B) {
+	packet := &BlockChangePacket{X: -100, Y: 64, Z: 100, Type: 1, Data: 2}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		marshalSink = packet.Marshal()
+	}
+}
+
+func BenchmarkReflectMarshalBlockChange(b *testing.B) {
+	packet := &BlockChangePacket{X: -100, Y: 64, Z: 100, Type: 1, Data: 2}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		marshalSink = reflectMarshal(BlockChangeId, packet.X, packet.Y, packet.Z, packet.Type, packet.Data)
+	}
+}
+
+func BenchmarkMarshalEntityTeleport(b *testing.B) {
+	packet := &EntityTeleportPacket{EntityId: 5, X: 320, Y: 2048, Z: 640, Yaw: 1, Pitch: 255}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		marshalSink = packet.Marshal()
+	}
+}
+
+func BenchmarkReflectMarshalEntityTeleport(b *testing.B) {
+	packet := &EntityTeleportPacket{EntityId: 5, X: 320, Y: 2048, Z: 640, Yaw: 1, Pitch: 255}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		marshalSink = reflectMarshal(EntityTeleportId, packet.EntityId, packet.X, packet.Y, packet.Z, packet.Yaw, packet.Pitch)
+	}
+}
+
+func BenchmarkAppendEntityTeleport(b *testing.B) {
+	packet := &EntityTeleportPacket{EntityId: 5, X: 320, Y: 2048, Z: 640, Yaw: 1, Pitch: 255}
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = packet.Append(buf[:0])
+	}
+}
@@ -0,0 +1,191 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidMetadata = errors.New("invalid metadata type")
+
+const metadataEnd = 0x7F
+
+// Type IDs encoded in the upper 3 bits of each entry's header
+const (
+	metadataByte = iota
+	metadataShort
+	metadataInt
+	metadataFloat
+	metadataString
+	metadataItemStack
+	metadataPosition
+)
+
+// Index 0 is a bit field shared by all entities
+const (
+	MetadataFlags      = 0
+	FlagOnFire    byte = 0x01
+	FlagCrouched  byte = 0x02
+	FlagRiding    byte = 0x04
+)
+
+// Valid only for sheep. The lower 4 bits are the wool color.
+const (
+	MetadataSheepWool      = 16
+	SheepSheared      byte = 0x10
+)
+
+// Valid only for creepers. The fuse state is -1 when idle and 1 when about to
+// explode.
+const (
+	MetadataCreeperFuse    = 16
+	MetadataCreeperPowered = 17
+)
+
+// A list of typed values keyed by index, used to describe the state of an
+// entity. Values must be one of byte, int16, int32, float32, string,
+// MetadataItemStack, or MetadataPosition.
+type Metadata []MetadataEntry
+
+type MetadataEntry struct {
+	// Must be less than 32. Floats can't use index 31 because their header
+	// would be the same as the end of the metadata.
+	Index byte
+	Value any
+}
+
+type MetadataItemStack struct {
+	ItemId int16
+	Count  byte
+	Damage int16
+}
+
+type MetadataPosition struct {
+	X int32
+	Y int32
+	Z int32
+}
+
+func (metadata Metadata) appendTo(buf []byte) []byte {
+	for _, entry := range metadata {
+		if entry.Index > 0x1F {
+			panic(fmt.Sprint("metadata index out of range: ", entry.Index))
+		}
+
+		switch value := entry.Value.(type) {
+		case byte:
+			buf = append(buf, metadataHeader(metadataByte, entry.Index), value)
+
+		case int16:
+			buf = append(buf, metadataHeader(metadataShort, entry.Index))
+			buf = appendShort(buf, value)
+
+		case int32:
+			buf = append(buf, metadataHeader(metadataInt, entry.Index))
+			buf = appendInt(buf, value)
+
+		case float32:
+			buf = append(buf, metadataHeader(metadataFloat, entry.Index))
+			buf = appendFloat(buf, value)
+
+		case string:
+			buf = append(buf, metadataHeader(metadataString, entry.Index))
+			buf = appendString(buf, value)
+
+		case MetadataItemStack:
+			buf = append(buf, metadataHeader(metadataItemStack, entry.Index))
+			buf = appendShort(buf, value.ItemId)
+			buf = append(buf, value.Count)
+			buf = appendShort(buf, value.Damage)
+
+		case MetadataPosition:
+			buf = append(buf, metadataHeader(metadataPosition, entry.Index))
+			buf = appendInt(buf, value.X)
+			buf = appendInt(buf, value.Y)
+			buf = appendInt(buf, value.Z)
+
+		default:
+			panic(fmt.Sprintf("unsupported metadata value %T", entry.Value))
+		}
+	}
+
+	return append(buf, metadataEnd)
+}
+
+// Packs the type and index of an entry into its header byte
+func metadataHeader(valueType byte, index byte) byte {
+	header := valueType<<5 | index
+	if header == metadataEnd {
+		panic(fmt.Sprint("metadata header at index ", index, " would end the metadata"))
+	}
+	return header
+}
+
+// Number of bytes appendTo will append. Unsupported values are counted as
+// empty and panic when appended.
+func (metadata Metadata) size() int {
+	size := 1
+	for _, entry := range metadata {
+		switch value := entry.Value.(type) {
+		case byte:
+			size += 2
+		case int16:
+			size += 3
+		case int32, float32:
+			size += 5
+		case string:
+			size += 1 + stringSize(value)
+		case MetadataItemStack:
+			size += 6
+		case MetadataPosition:
+			size += 13
+		}
+	}
+	return size
+}
+
+func (reader *packetReader) readMetadata() Metadata {
+	metadata := make(Metadata, 0)
+
+	for reader.err == nil {
+		header := reader.readByte()
+		if reader.err != nil || header == metadataEnd {
+			break
+		}
+
+		entry := MetadataEntry{Index: header & 0x1F}
+
+		switch header >> 5 {
+		case metadataByte:
+			entry.Value = reader.readByte()
+		case metadataShort:
+			entry.Value = reader.readShort()
+		case metadataInt:
+			entry.Value = reader.readInt()
+		case metadataFloat:
+			entry.Value = reader.readFloat()
+		case metadataString:
+			entry.Value = reader.readString(64)
+		case metadataItemStack:
+			entry.Value = MetadataItemStack{
+				ItemId: reader.readShort(),
+				Count:  reader.readByte(),
+				Damage: reader.readShort(),
+			}
+		case metadataPosition:
+			entry.Value = MetadataPosition{
+				X: reader.readInt(),
+				Y: reader.readInt(),
+				Z: reader.readInt(),
+			}
+		default:
+			reader.err = ErrInvalidMetadata
+		}
+
+		metadata = append(metadata, entry)
+	}
+
+	if reader.err != nil {
+		return nil
+	}
+	return metadata
+}
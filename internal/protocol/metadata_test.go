@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	packet := &EntityMetadataPacket{
+		EntityId: 12,
+		Metadata: Metadata{
+			{Index: MetadataFlags, Value: FlagOnFire | FlagCrouched},
+			{Index: 1, Value: int16(-300)},
+			{Index: MetadataCreeperFuse, Value: byte(0xFF)},
+			{Index: MetadataCreeperPowered, Value: byte(1)},
+			{Index: 18, Value: int32(-1)},
+			{Index: 19, Value: float32(0.25)},
+			{Index: 20, Value: "§cname"},
+			{Index: 21, Value: MetadataItemStack{ItemId: 276, Count: 1, Damage: 12}},
+			{Index: 0x1F, Value: MetadataPosition{X: -1, Y: 64, Z: 300}},
+		},
+	}
+
+	data := packet.Marshal()
+	if data[len(data)-1] != metadataEnd {
+		t.Fatalf("metadata doesn't end with %d", metadataEnd)
+	}
+
+	decoded, err := new(EntityMetadataPacket).Unmarshal(bufio.NewReader(bytes.NewReader(data[1:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, packet) {
+		t.Fatalf("expected %+v but got %+v", packet, decoded)
+	}
+}
+
+func TestMetadataHeader(t *testing.T) {
+	data := Metadata{{Index: 17, Value: int32(1)}}.appendTo(nil)
+	// The type is in the upper 3 bits and the index in the lower 5
+	if data[0] != metadataInt<<5|17 {
+		t.Fatalf("header is %08b", data[0])
+	}
+}
+
+func TestInvalidMetadataType(t *testing.T) {
+	data := []byte{0, 0, 0, 1, 7<<5 | 1, 0, metadataEnd}
+	if _, err := new(EntityMetadataPacket).Unmarshal(bufio.NewReader(bytes.NewReader(data))); err != ErrInvalidMetadata {
+		t.Fatalf("expected ErrInvalidMetadata but got %v", err)
+	}
+}
+
+func TestMetadataIndexOutOfRange(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("index 32 was encoded")
+		}
+	}()
+	Metadata{{Index: 32, Value: byte(0)}}.appendTo(nil)
+}
+
+func TestMetadataHeaderConflictsWithEnd(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("float at index 31 was encoded")
+		}
+	}()
+	Metadata{{Index: 0x1F, Value: float32(1)}}.appendTo(nil)
+}
@@ -3,6 +3,7 @@ package protocol
 import (
 	"bufio"
 	"errors"
+	"fmt"
 )
 
 var (
@@ -14,6 +15,10 @@ type InboundPacket[Self any] interface {
 }
 
 type OutboundPacket interface {
+	// Appends the encoded packet to the buffer and returns the extended
+	// buffer, allowing one buffer to be reused for many packets
+	Append(buf []byte) []byte
+	// Encodes the packet into a new buffer of the exact size needed
 	Marshal() []byte
 }
 
@@ -49,6 +54,8 @@ func ReadNextPacket(r *bufio.Reader) (any, error) {
 		return new(HandshakePacket).Unmarshal(r)
 	case ChatId:
 		return new(ChatPacket).Unmarshal(r)
+	case RespawnId:
+		return new(RespawnPacket).Unmarshal(r)
 	case SetOnGroundId:
 		return new(SetOnGroundPacket).Unmarshal(r)
 	case SetPositionId:
@@ -86,8 +93,12 @@ func (pkt *KeepAlivePacket) Unmarshal(*bufio.Reader) (*KeepAlivePacket, error) {
 	return pkt, nil
 }
 
+func (pkt *KeepAlivePacket) Append(buf []byte) []byte {
+	return append(buf, KeepAliveId)
+}
+
 func (pkt *KeepAlivePacket) Marshal() []byte {
-	return marshal(KeepAliveId)
+	return pkt.Append(make([]byte, 0, 1))
 }
 
 const LoginId = 1
@@ -108,13 +119,16 @@ func (pkt *LoginPacket) Unmarshal(r *bufio.Reader) (*LoginPacket, error) {
 	return pkt, reader.err
 }
 
+func (pkt *LoginPacket) Append(buf []byte) []byte {
+	buf = append(buf, LoginId)
+	buf = appendInt(buf, pkt.ProtocolVersion)
+	buf = appendString(buf, pkt.Username)
+	buf = appendLong(buf, pkt.MapSeed)
+	return append(buf, pkt.Dimension)
+}
+
 func (pkt *LoginPacket) Marshal() []byte {
-	return marshal(LoginId,
-		pkt.ProtocolVersion,
-		pkt.Username,
-		pkt.MapSeed,
-		pkt.Dimension,
-	)
+	return pkt.Append(make([]byte, 0, 14+stringSize(pkt.Username)))
 }
 
 const HandshakeId = 2
@@ -129,8 +143,13 @@ func (pkt *HandshakePacket) Unmarshal(r *bufio.Reader) (*HandshakePacket, error)
 	return pkt, reader.err
 }
 
+func (pkt *HandshakePacket) Append(buf []byte) []byte {
+	buf = append(buf, HandshakeId)
+	return appendString(buf, pkt.Username)
+}
+
 func (pkt *HandshakePacket) Marshal() []byte {
-	return marshal(HandshakeId, pkt.Username)
+	return pkt.Append(make([]byte, 0, 1+stringSize(pkt.Username)))
 }
 
 const ChatId = 3
@@ -145,8 +164,98 @@ func (pkt *ChatPacket) Unmarshal(r *bufio.Reader) (*ChatPacket, error) {
 	return pkt, reader.err
 }
 
+func (pkt *ChatPacket) Append(buf []byte) []byte {
+	buf = append(buf, ChatId)
+	return appendString(buf, pkt.Message)
+}
+
 func (pkt *ChatPacket) Marshal() []byte {
-	return marshal(ChatId, pkt.Message)
+	return pkt.Append(make([]byte, 0, 1+stringSize(pkt.Message)))
+}
+
+const TimeUpdateId = 4
+
+type TimeUpdatePacket struct {
+	// Ticks since the world was created. The time of day is this modulo 24000.
+	Time int64
+}
+
+func (pkt *TimeUpdatePacket) Append(buf []byte) []byte {
+	buf = append(buf, TimeUpdateId)
+	return appendLong(buf, pkt.Time)
+}
+
+func (pkt *TimeUpdatePacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 9))
+}
+
+const EntityEquipmentId = 5
+
+// Slots of an entity's visible equipment
+const (
+	EquipmentHeld int16 = iota
+	EquipmentBoots
+	EquipmentLeggings
+	EquipmentChestplate
+	EquipmentHelmet
+)
+
+type EntityEquipmentPacket struct {
+	EntityId int32
+	Slot     int16
+	// -1 if the slot is empty
+	ItemId int16
+	Damage int16
+}
+
+func (pkt *EntityEquipmentPacket) Append(buf []byte) []byte {
+	buf = append(buf, EntityEquipmentId)
+	buf = appendInt(buf, pkt.EntityId)
+	buf = appendShort(buf, pkt.Slot)
+	buf = appendShort(buf, pkt.ItemId)
+	return appendShort(buf, pkt.Damage)
+}
+
+func (pkt *EntityEquipmentPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 11))
+}
+
+const UpdateHealthId = 8
+
+type UpdateHealthPacket struct {
+	Health int16
+}
+
+func (pkt *UpdateHealthPacket) Append(buf []byte) []byte {
+	buf = append(buf, UpdateHealthId)
+	return appendShort(buf, pkt.Health)
+}
+
+func (pkt *UpdateHealthPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 3))
+}
+
+const RespawnId = 9
+
+// Sent by the server to change the player's dimension, and by the client when
+// respawning after death
+type RespawnPacket struct {
+	Dimension byte
+}
+
+func (pkt *RespawnPacket) Unmarshal(r *bufio.Reader) (*RespawnPacket, error) {
+	reader := newPacketReader(r)
+	pkt.Dimension = reader.readByte()
+	return pkt, reader.err
+}
+
+func (pkt *RespawnPacket) Append(buf []byte) []byte {
+	buf = append(buf, RespawnId)
+	return append(buf, pkt.Dimension)
+}
+
+func (pkt *RespawnPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 2))
 }
 
 const SetOnGroundId = 10
@@ -181,14 +290,17 @@ func (pkt *SetPositionPacket) Unmarshal(r *bufio.Reader) (*SetPositionPacket, er
 	return pkt, reader.err
 }
 
+func (pkt *SetPositionPacket) Append(buf []byte) []byte {
+	buf = append(buf, SetPositionId)
+	buf = appendDouble(buf, pkt.X)
+	buf = appendDouble(buf, pkt.Y)
+	buf = appendDouble(buf, pkt.Stance)
+	buf = appendDouble(buf, pkt.Z)
+	return appendBool(buf, pkt.OnGround)
+}
+
 func (pkt *SetPositionPacket) Marshal() []byte {
-	return marshal(11,
-		pkt.X,
-		pkt.Y,
-		pkt.Stance,
-		pkt.Z,
-		pkt.OnGround,
-	)
+	return pkt.Append(make([]byte, 0, 34))
 }
 
 const SetAngleId = 12
@@ -233,6 +345,16 @@ func (pkt *SetAngleAndPositionPacket) Unmarshal(r *bufio.Reader) (*SetAngleAndPo
 
 const DigId = 14
 
+const (
+	DigStarted byte = iota
+	_
+	DigFinished
+	_
+	DigDropItem
+	// Sent when the player stops using an item, such as releasing a bow
+	DigReleaseItem
+)
+
 type DigPacket struct {
 	Status byte
 	X      int32
@@ -303,6 +425,15 @@ func (pkt *SetHotbarSelectionPacket) Unmarshal(r *bufio.Reader) (*SetHotbarSelec
 
 const AnimationId = 18
 
+const (
+	AnimationNone byte = iota
+	AnimationSwingArm
+	AnimationDamage
+	AnimationLeaveBed
+	AnimationCrouch   byte = 104
+	AnimationUncrouch byte = 105
+)
+
 type AnimationPacket struct {
 	EntityId int32
 	Animate  byte
@@ -315,6 +446,16 @@ func (pkt *AnimationPacket) Unmarshal(r *bufio.Reader) (*AnimationPacket, error)
 	return pkt, reader.err
 }
 
+func (pkt *AnimationPacket) Append(buf []byte) []byte {
+	buf = append(buf, AnimationId)
+	buf = appendInt(buf, pkt.EntityId)
+	return append(buf, pkt.Animate)
+}
+
+func (pkt *AnimationPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 6))
+}
+
 const EntityActionId = 19
 
 type EntityAction byte
@@ -337,6 +478,177 @@ func (pkt *EntityActionPacket) Unmarshal(r *bufio.Reader) (*EntityActionPacket,
 	return pkt, reader.err
 }
 
+const NamedEntitySpawnId = 20
+
+// Coordinates are absolute integers (block position * 32) and angles are
+// fractions of a full turn out of 256
+type NamedEntitySpawnPacket struct {
+	EntityId    int32
+	Username    string
+	X           int32
+	Y           int32
+	Z           int32
+	Yaw         byte
+	Pitch       byte
+	CurrentItem int16
+}
+
+func (pkt *NamedEntitySpawnPacket) Append(buf []byte) []byte {
+	buf = append(buf, NamedEntitySpawnId)
+	buf = appendInt(buf, pkt.EntityId)
+	buf = appendString(buf, pkt.Username)
+	buf = appendInt(buf, pkt.X)
+	buf = appendInt(buf, pkt.Y)
+	buf = appendInt(buf, pkt.Z)
+	buf = append(buf, pkt.Yaw, pkt.Pitch)
+	return appendShort(buf, pkt.CurrentItem)
+}
+
+func (pkt *NamedEntitySpawnPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 21+stringSize(pkt.Username)))
+}
+
+const AddObjectId = 23
+
+// Types of objects that can be spawned with AddObjectPacket
+const (
+	ObjectBoat            byte = 1
+	ObjectMinecart        byte = 10
+	ObjectChestMinecart   byte = 11
+	ObjectFurnaceMinecart byte = 12
+	ObjectTnt             byte = 50
+	ObjectArrow           byte = 60
+	ObjectSnowball        byte = 61
+	ObjectEgg             byte = 62
+	ObjectFallingSand     byte = 70
+	ObjectFallingGravel   byte = 71
+)
+
+// See NamedEntitySpawnPacket for the encoding of coordinates and
+// EntityVelocityPacket for velocity
+type AddObjectPacket struct {
+	EntityId int32
+	Type     byte
+	X        int32
+	Y        int32
+	Z        int32
+	// The velocity is only sent when this is greater than 0
+	ThrowerId int32
+	VelocityX int16
+	VelocityY int16
+	VelocityZ int16
+}
+
+func (pkt *AddObjectPacket) Append(buf []byte) []byte {
+	buf = append(buf, AddObjectId)
+	buf = appendInt(buf, pkt.EntityId)
+	buf = append(buf, pkt.Type)
+	buf = appendInt(buf, pkt.X)
+	buf = appendInt(buf, pkt.Y)
+	buf = appendInt(buf, pkt.Z)
+	buf = appendInt(buf, pkt.ThrowerId)
+	if pkt.ThrowerId > 0 {
+		buf = appendShort(buf, pkt.VelocityX)
+		buf = appendShort(buf, pkt.VelocityY)
+		buf = appendShort(buf, pkt.VelocityZ)
+	}
+	return buf
+}
+
+func (pkt *AddObjectPacket) Marshal() []byte {
+	size := 22
+	if pkt.ThrowerId > 0 {
+		size += 6
+	}
+	return pkt.Append(make([]byte, 0, size))
+}
+
+const EntityVelocityId = 28
+
+// Velocity is in 1/8000 of a block per tick
+type EntityVelocityPacket struct {
+	EntityId  int32
+	VelocityX int16
+	VelocityY int16
+	VelocityZ int16
+}
+
+func (pkt *EntityVelocityPacket) Append(buf []byte) []byte {
+	buf = append(buf, EntityVelocityId)
+	buf = appendInt(buf, pkt.EntityId)
+	buf = appendShort(buf, pkt.VelocityX)
+	buf = appendShort(buf, pkt.VelocityY)
+	return appendShort(buf, pkt.VelocityZ)
+}
+
+func (pkt *EntityVelocityPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 11))
+}
+
+const DestroyEntityId = 29
+
+type DestroyEntityPacket struct {
+	EntityId int32
+}
+
+func (pkt *DestroyEntityPacket) Append(buf []byte) []byte {
+	buf = append(buf, DestroyEntityId)
+	return appendInt(buf, pkt.EntityId)
+}
+
+func (pkt *DestroyEntityPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 5))
+}
+
+const EntityTeleportId = 34
+
+// See NamedEntitySpawnPacket for the encoding of coordinates and angles
+type EntityTeleportPacket struct {
+	EntityId int32
+	X        int32
+	Y        int32
+	Z        int32
+	Yaw      byte
+	Pitch    byte
+}
+
+func (pkt *EntityTeleportPacket) Append(buf []byte) []byte {
+	buf = append(buf, EntityTeleportId)
+	buf = appendInt(buf, pkt.EntityId)
+	buf = appendInt(buf, pkt.X)
+	buf = appendInt(buf, pkt.Y)
+	buf = appendInt(buf, pkt.Z)
+	return append(buf, pkt.Yaw, pkt.Pitch)
+}
+
+func (pkt *EntityTeleportPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 19))
+}
+
+const EntityMetadataId = 40
+
+type EntityMetadataPacket struct {
+	EntityId int32
+	Metadata Metadata
+}
+
+func (pkt *EntityMetadataPacket) Unmarshal(r *bufio.Reader) (*EntityMetadataPacket, error) {
+	reader := newPacketReader(r)
+	pkt.EntityId = reader.readInt()
+	pkt.Metadata = reader.readMetadata()
+	return pkt, reader.err
+}
+
+func (pkt *EntityMetadataPacket) Append(buf []byte) []byte {
+	buf = append(buf, EntityMetadataId)
+	buf = appendInt(buf, pkt.EntityId)
+	return pkt.Metadata.appendTo(buf)
+}
+
+func (pkt *EntityMetadataPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 5+pkt.Metadata.size()))
+}
+
 const PreChunkId = 50
 
 type PreChunkPacket struct {
@@ -346,12 +658,15 @@ type PreChunkPacket struct {
 	Load bool
 }
 
+func (pkt *PreChunkPacket) Append(buf []byte) []byte {
+	buf = append(buf, PreChunkId)
+	buf = appendInt(buf, pkt.ChunkX)
+	buf = appendInt(buf, pkt.ChunkZ)
+	return appendBool(buf, pkt.Load)
+}
+
 func (pkt *PreChunkPacket) Marshal() []byte {
-	return marshal(50,
-		pkt.ChunkX,
-		pkt.ChunkZ,
-		pkt.Load,
-	)
+	return pkt.Append(make([]byte, 0, 10))
 }
 
 const ChunkDataId = 51
@@ -366,16 +681,47 @@ type ChunkDataPacket struct {
 	Data   []byte
 }
 
+func (pkt *ChunkDataPacket) Append(buf []byte) []byte {
+	buf = append(buf, ChunkDataId)
+	buf = appendInt(buf, pkt.StartX)
+	buf = appendShort(buf, pkt.StartY)
+	buf = appendInt(buf, pkt.StartZ)
+	buf = append(buf, pkt.XSize, pkt.YSize, pkt.ZSize)
+	return appendByteArray(buf, pkt.Data)
+}
+
 func (pkt *ChunkDataPacket) Marshal() []byte {
-	return marshal(ChunkDataId,
-		pkt.StartX,
-		pkt.StartY,
-		pkt.StartZ,
-		pkt.XSize,
-		pkt.YSize,
-		pkt.ZSize,
-		pkt.Data,
-	)
+	return pkt.Append(make([]byte, 0, 18+len(pkt.Data)))
+}
+
+const MultiBlockChangeId = 52
+
+// Changes blocks in a single chunk. Each index of the slices describes one
+// block.
+type MultiBlockChangePacket struct {
+	ChunkX int32
+	ChunkZ int32
+	// Relative to the chunk, packed as x << 12 | z << 8 | y
+	Positions []int16
+	Types     []byte
+	Data      []byte
+}
+
+func (pkt *MultiBlockChangePacket) Append(buf []byte) []byte {
+	count := len(pkt.Positions)
+	buf = append(buf, MultiBlockChangeId)
+	buf = appendInt(buf, pkt.ChunkX)
+	buf = appendInt(buf, pkt.ChunkZ)
+	buf = appendShort(buf, int16(count))
+	for _, pos := range pkt.Positions {
+		buf = appendShort(buf, pos)
+	}
+	buf = append(buf, pkt.Types[:count]...)
+	return append(buf, pkt.Data[:count]...)
+}
+
+func (pkt *MultiBlockChangePacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 11+len(pkt.Positions)*4))
 }
 
 const BlockChangeId = 53
@@ -388,14 +734,62 @@ type BlockChangePacket struct {
 	Data byte
 }
 
+func (pkt *BlockChangePacket) Append(buf []byte) []byte {
+	buf = append(buf, BlockChangeId)
+	buf = appendInt(buf, pkt.X)
+	buf = append(buf, pkt.Y)
+	buf = appendInt(buf, pkt.Z)
+	return append(buf, pkt.Type, pkt.Data)
+}
+
 func (pkt *BlockChangePacket) Marshal() []byte {
-	return marshal(BlockChangeId,
-		pkt.X,
-		pkt.Y,
-		pkt.Z,
-		pkt.Type,
-		pkt.Data,
-	)
+	return pkt.Append(make([]byte, 0, 12))
+}
+
+const NewStateId = 70
+
+// Reasons for a new state
+const (
+	StateInvalidBed byte = iota
+	StateBeginRain
+	StateEndRain
+)
+
+type NewStatePacket struct {
+	Reason byte
+}
+
+func (pkt *NewStatePacket) Append(buf []byte) []byte {
+	buf = append(buf, NewStateId)
+	return append(buf, pkt.Reason)
+}
+
+func (pkt *NewStatePacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 2))
+}
+
+const ThunderboltId = 71
+
+type ThunderboltPacket struct {
+	EntityId int32
+	// Absolute integers (block position * 32)
+	X int32
+	Y int32
+	Z int32
+}
+
+func (pkt *ThunderboltPacket) Append(buf []byte) []byte {
+	buf = append(buf, ThunderboltId)
+	buf = appendInt(buf, pkt.EntityId)
+	// The unknown boolean is always true
+	buf = appendBool(buf, true)
+	buf = appendInt(buf, pkt.X)
+	buf = appendInt(buf, pkt.Y)
+	return appendInt(buf, pkt.Z)
+}
+
+func (pkt *ThunderboltPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 18))
 }
 
 const CloseInventoryId = 101
@@ -448,24 +842,29 @@ type SetSlotPacket struct {
 	Damage    int16
 }
 
+func (pkt *SetSlotPacket) Append(buf []byte) []byte {
+	buf = append(buf, SetSlotId, pkt.WindowId)
+	buf = appendShort(buf, pkt.Slot)
+	buf = appendShort(buf, pkt.ItemId)
+	if pkt.ItemId >= 0 {
+		buf = append(buf, pkt.StackSize)
+		buf = appendShort(buf, pkt.Damage)
+	}
+	return buf
+}
+
 func (pkt *SetSlotPacket) Marshal() []byte {
+	size := 6
 	if pkt.ItemId >= 0 {
-		return marshal(SetSlotId,
-			pkt.WindowId,
-			pkt.Slot,
-			pkt.ItemId,
-			pkt.StackSize,
-			pkt.Damage,
-		)
-	} else {
-		return marshal(SetSlotId,
-			pkt.WindowId,
-			pkt.Slot,
-			pkt.ItemId,
-		)
+		size += 3
 	}
+	return pkt.Append(make([]byte, 0, size))
 }
 
+// Sent by clients refreshing the server list instead of a handshake. It has no
+// fields and is answered with a disconnect packet describing the server.
+const ServerListPingId = 254
+
 const DisconnectId = 255
 
 type DisconnectPacket struct {
@@ -474,6 +873,51 @@ type DisconnectPacket struct {
 
 func (pkt *DisconnectPacket) Unmarshal(r *bufio.Reader) (*DisconnectPacket, error) {
 	reader := newPacketReader(r)
-	pkt.Message = reader.readString(100)
+	pkt.Message = reader.readString(maxDisconnectLength)
 	return pkt, reader.err
 }
+
+// Maximum length of a disconnect message that clients accept
+const maxDisconnectLength = 100
+
+// Creates a disconnect packet with the reason, shortening it if clients would
+// reject it
+func NewKick(reason string) *DisconnectPacket {
+	return &DisconnectPacket{Message: truncateString(reason, maxDisconnectLength)}
+}
+
+// Creates the disconnect packet that answers a server list ping, in the format
+// "motd§online§max". The MOTD is shortened so that the whole response fits in
+// a disconnect message.
+func NewServerListResponse(motd string, onlinePlayers, maxPlayers int) *DisconnectPacket {
+	counts := fmt.Sprintf("§%d§%d", onlinePlayers, maxPlayers)
+	motd = truncateString(motd, maxDisconnectLength-utf16Length(counts))
+	return &DisconnectPacket{Message: motd + counts}
+}
+
+// Shortens the string to at most maxLen UTF-16 code units without splitting
+// a character
+func truncateString(str string, maxLen int) string {
+	length := 0
+	for i, r := range str {
+		units := 1
+		if r >= 0x10000 {
+			units = 2
+		}
+
+		if length+units > maxLen {
+			return str[:i]
+		}
+		length += units
+	}
+	return str
+}
+
+func (pkt *DisconnectPacket) Append(buf []byte) []byte {
+	buf = append(buf, DisconnectId)
+	return appendString(buf, pkt.Message)
+}
+
+func (pkt *DisconnectPacket) Marshal() []byte {
+	return pkt.Append(make([]byte, 0, 1+stringSize(pkt.Message)))
+}
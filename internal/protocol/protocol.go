@@ -1,59 +1,92 @@
 package protocol
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"io"
-	"reflect"
+	"math"
+	"strings"
 	"unicode/utf16"
+	"unicode/utf8"
 )
 
 var (
-	ErrInvalidBool   = errors.New("not a valid boolean value")
-	ErrInvalidString = errors.New("invalid string length")
+	ErrInvalidBool    = errors.New("not a valid boolean value")
+	ErrInvalidString  = errors.New("invalid string length")
+	ErrPacketTooLarge = errors.New("packet too large")
 )
 
+// Maximum number of bytes a single inbound packet may span. This bounds the
+// work done for packets with repeated fields, such as entity metadata.
+const maxPacketSize = 32 * 1024
+
 type packetReader struct {
 	err error
-	r   io.Reader
+	r   *bufio.Reader
+	// Bytes that may still be read before the packet is too large
+	remaining int
 }
 
-func newPacketReader(r io.Reader) *packetReader {
+func newPacketReader(r *bufio.Reader) *packetReader {
 	return &packetReader{
-		err: nil,
-		r:   r,
+		err:       nil,
+		r:         r,
+		remaining: maxPacketSize,
 	}
 }
 
-func (reader *packetReader) readByte() byte {
+// Returns the next n bytes and advances past them. The returned slice is only
+// valid until the next read.
+func (reader *packetReader) next(n int) []byte {
 	if reader.err != nil {
-		return 0
+		return nil
+	}
+
+	if n > reader.remaining {
+		reader.err = ErrPacketTooLarge
+		return nil
 	}
+	reader.remaining -= n
 
-	var buf [1]byte
-	if _, err := reader.r.Read(buf[:]); err != nil {
+	if n > reader.r.Size() {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader.r, buf); err != nil {
+			reader.err = err
+			return nil
+		}
+		return buf
+	}
+
+	buf, err := reader.r.Peek(n)
+	if err != nil {
+		// Match the errors of io.ReadFull
+		if err == io.EOF && len(buf) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
 		reader.err = err
-		return 0
+		return nil
 	}
+	reader.r.Discard(n)
+	return buf
+}
 
-	return buf[0]
+func (reader *packetReader) readByte() byte {
+	if buf := reader.next(1); buf != nil {
+		return buf[0]
+	}
+	return 0
 }
 
 func (reader *packetReader) readBool() bool {
+	b := reader.readByte()
 	if reader.err != nil {
 		return false
 	}
 
-	var buf [1]byte
-	if _, err := reader.r.Read(buf[:]); err != nil {
-		reader.err = err
-		return false
-	}
-
-	if buf[0] == 0 {
+	if b == 0 {
 		return false
-	} else if buf[0] == 1 {
+	} else if b == 1 {
 		return true
 	} else {
 		reader.err = ErrInvalidBool
@@ -62,154 +95,144 @@ func (reader *packetReader) readBool() bool {
 }
 
 func (reader *packetReader) readShort() int16 {
-	if reader.err != nil {
-		return 0
+	if buf := reader.next(2); buf != nil {
+		return int16(binary.BigEndian.Uint16(buf))
 	}
-
-	var i int16
-	if err := binary.Read(reader.r, binary.BigEndian, &i); err != nil {
-		reader.err = err
-		return 0
-	}
-	return i
+	return 0
 }
 
 func (reader *packetReader) readInt() int32 {
-	if reader.err != nil {
-		return 0
+	if buf := reader.next(4); buf != nil {
+		return int32(binary.BigEndian.Uint32(buf))
 	}
-
-	var i int32
-	if err := binary.Read(reader.r, binary.BigEndian, &i); err != nil {
-		reader.err = err
-		return 0
-	}
-	return i
+	return 0
 }
 
 func (reader *packetReader) readLong() int64 {
-	if reader.err != nil {
-		return 0
+	if buf := reader.next(8); buf != nil {
+		return int64(binary.BigEndian.Uint64(buf))
 	}
-
-	var i int64
-	if err := binary.Read(reader.r, binary.BigEndian, &i); err != nil {
-		reader.err = err
-		return 0
-	}
-	return i
+	return 0
 }
 
 func (reader *packetReader) readFloat() float32 {
-	if reader.err != nil {
-		return 0
-	}
-
-	var f float32
-	if err := binary.Read(reader.r, binary.BigEndian, &f); err != nil {
-		reader.err = err
-		return 0
+	if buf := reader.next(4); buf != nil {
+		return math.Float32frombits(binary.BigEndian.Uint32(buf))
 	}
-	return f
+	return 0
 }
 
 func (reader *packetReader) readDouble() float64 {
-	if reader.err != nil {
-		return 0
-	}
-
-	var f float64
-	if err := binary.Read(reader.r, binary.BigEndian, &f); err != nil {
-		reader.err = err
-		return 0
+	if buf := reader.next(8); buf != nil {
+		return math.Float64frombits(binary.BigEndian.Uint64(buf))
 	}
-	return f
+	return 0
 }
 
 // Reads a string encoded according to the Minecraft protocol
 func (reader *packetReader) readString(maxLen uint16) string {
+	length := int(reader.readShort())
 	if reader.err != nil {
 		return ""
 	}
 
-	var length int16
-	if err := binary.Read(reader.r, binary.BigEndian, &length); err != nil {
-		reader.err = err
-		return ""
-	}
-
-	if length < 0 || length > int16(maxLen) {
+	if length < 0 || length > int(maxLen) {
 		reader.err = ErrInvalidString
 		return ""
 	}
 
-	data := make([]uint16, length)
-	if err := binary.Read(reader.r, binary.BigEndian, data); err != nil {
-		reader.err = err
+	data := reader.next(length * 2)
+	if reader.err != nil {
 		return ""
 	}
 
-	return string(utf16.Decode(data))
-}
-
-// Encodes a struct's fields in the order they are declared and returns the
-// bytes
-func marshal(packetId byte, fields ...any) []byte {
-	buf := bytes.NewBuffer(make([]byte, 0))
-	buf.WriteByte(packetId)
-
-	for _, field := range fields {
-		val := reflect.ValueOf(field)
-
-		switch val.Kind() {
-		case reflect.Bool:
-			if val.Bool() {
-				buf.WriteByte(1)
+	// Unpaired surrogates are replaced like utf16.Decode does. Each code unit
+	// takes at most 3 bytes in UTF-8.
+	var builder strings.Builder
+	builder.Grow(length * 3)
+	for i := 0; i < length; i++ {
+		r := rune(binary.BigEndian.Uint16(data[i*2:]))
+		if utf16.IsSurrogate(r) {
+			if i+1 < length {
+				r = utf16.DecodeRune(r, rune(binary.BigEndian.Uint16(data[i*2+2:])))
 			} else {
-				buf.WriteByte(0)
+				r = utf8.RuneError
+			}
+			if r != utf8.RuneError {
+				i++
 			}
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
 
-		case reflect.Uint8:
-			buf.WriteByte(byte(val.Uint()))
+// The functions below append values encoded according to the Minecraft
+// protocol to a buffer and return the extended buffer, like the append
+// builtin. Packets are encoded by appending each of their fields in order.
 
-		case reflect.Int16:
-			binary.Write(buf, binary.BigEndian, int16(val.Int()))
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
 
-		case reflect.Int32:
-			binary.Write(buf, binary.BigEndian, int32(val.Int()))
+func appendShort(buf []byte, i int16) []byte {
+	return binary.BigEndian.AppendUint16(buf, uint16(i))
+}
 
-		case reflect.Int64:
-			binary.Write(buf, binary.BigEndian, val.Int())
+func appendInt(buf []byte, i int32) []byte {
+	return binary.BigEndian.AppendUint32(buf, uint32(i))
+}
 
-		case reflect.Float64:
-			binary.Write(buf, binary.BigEndian, val.Float())
+func appendLong(buf []byte, i int64) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(i))
+}
 
-		case reflect.String:
-			writeString(buf, val.String())
+func appendFloat(buf []byte, f float32) []byte {
+	return binary.BigEndian.AppendUint32(buf, math.Float32bits(f))
+}
 
-		case reflect.Slice:
-			if reflect.TypeOf(field).Elem().Kind() != reflect.Uint8 {
-				panic("only []byte is supported")
-			}
-			slice := val.Interface().([]byte)
-			binary.Write(buf, binary.BigEndian, int32(len(slice)))
-			buf.Write(slice)
+func appendDouble(buf []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+}
 
-		default:
-			panic("marshal: unsupported field type")
+// Appends a string encoded according to the Minecraft protocol
+func appendString(buf []byte, str string) []byte {
+	buf = appendShort(buf, int16(utf16Length(str)))
+	for _, r := range str {
+		if r >= 0x10000 {
+			r1, r2 := utf16.EncodeRune(r)
+			buf = binary.BigEndian.AppendUint16(buf, uint16(r1))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(r2))
+		} else {
+			buf = binary.BigEndian.AppendUint16(buf, uint16(r))
 		}
 	}
-
-	return buf.Bytes()
+	return buf
 }
 
-// Writes a string encoded according to the Minecraft protocol
-func writeString(writer io.Writer, str string) error {
-	data := utf16.Encode([]rune(str))
+// Appends a byte array prefixed with its length
+func appendByteArray(buf []byte, data []byte) []byte {
+	buf = appendInt(buf, int32(len(data)))
+	return append(buf, data...)
+}
 
-	if err := binary.Write(writer, binary.BigEndian, int16(len(data))); err != nil {
-		return err
+// Number of UTF-16 code units needed to encode the string
+func utf16Length(str string) int {
+	length := 0
+	for _, r := range str {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
 	}
+	return length
+}
 
-	return binary.Write(writer, binary.BigEndian, data)
+// Number of bytes appendString will append for the string
+func stringSize(str string) int {
+	return 2 + utf16Length(str)*2
 }
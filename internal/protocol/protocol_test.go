@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func newTestReader(data []byte) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(data))
+}
+
+func TestReadNextPacket(t *testing.T) {
+	data := []byte{
+		SetAngleAndPositionId,
+		0x40, 0x59, 0, 0, 0, 0, 0, 0, // 100
+		0x40, 0x50, 0, 0, 0, 0, 0, 0, // 64
+		0x40, 0x50, 0x60, 0, 0, 0, 0, 0, // 65.5
+		0xC0, 0x24, 0, 0, 0, 0, 0, 0, // -10
+		0x42, 0xB4, 0, 0, // 90
+		0xC1, 0xA0, 0, 0, // -20
+		1,
+	}
+
+	packet, err := ReadNextPacket(newTestReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &SetAngleAndPositionPacket{X: 100, Y: 64, Stance: 65.5, Z: -10, Yaw: 90, Pitch: -20, OnGround: true}
+	if !reflect.DeepEqual(packet, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, packet)
+	}
+}
+
+func TestReadString(t *testing.T) {
+	tests := []string{"", "Notch", "§ehéllo", "🌍 world"}
+	for _, str := range tests {
+		data := appendString(nil, str)
+		reader := newPacketReader(newTestReader(data))
+		if actual := reader.readString(16); actual != str || reader.err != nil {
+			t.Errorf("expected %q but got %q (%v)", str, actual, reader.err)
+		}
+	}
+}
+
+func TestReadUnpairedSurrogates(t *testing.T) {
+	units := []uint16{0xD800, 'a', 0xDC00, 0xD83C, 0xDF0D, 0xDBFF}
+	data := appendShort(nil, int16(len(units)))
+	for _, unit := range units {
+		data = appendShort(data, int16(unit))
+	}
+
+	reader := newPacketReader(newTestReader(data))
+	expected := string(utf16.Decode(units))
+	if actual := reader.readString(16); actual != expected {
+		t.Fatalf("expected %q but got %q", expected, actual)
+	}
+}
+
+func TestReadInvalidString(t *testing.T) {
+	for _, length := range []int16{-1, 17} {
+		reader := newPacketReader(newTestReader(appendShort(nil, length)))
+		reader.readString(16)
+		if reader.err != ErrInvalidString {
+			t.Errorf("length %d: expected ErrInvalidString but got %v", length, reader.err)
+		}
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	reader := newPacketReader(newTestReader([]byte{0, 0, 1}))
+	reader.readInt()
+	if reader.err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF but got %v", reader.err)
+	}
+
+	reader = newPacketReader(newTestReader(nil))
+	reader.readInt()
+	if reader.err != io.EOF {
+		t.Fatalf("expected io.EOF but got %v", reader.err)
+	}
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	// Entity metadata has no length prefix, so the size guard is the only
+	// limit on how many entries are read
+	data := []byte{0, 0, 0, 1}
+	for len(data) < maxPacketSize+2 {
+		data = append(data, metadataByte<<5, 0)
+	}
+
+	_, err := new(EntityMetadataPacket).Unmarshal(newTestReader(data))
+	if !errors.Is(err, ErrPacketTooLarge) {
+		t.Fatalf("expected ErrPacketTooLarge but got %v", err)
+	}
+}
+
+func BenchmarkReadNextPacket(b *testing.B) {
+	var data []byte
+	data = (&ChatPacket{Message: strings.Repeat("a", 100)}).Append(data)
+	for i := 0; i < 20; i++ {
+		data = append(data, SetAngleAndPositionId)
+		data = appendDouble(data, 100)
+		data = appendDouble(data, 64)
+		data = appendDouble(data, 65.62)
+		data = appendDouble(data, -10)
+		data = appendFloat(data, 90)
+		data = appendFloat(data, -20)
+		data = appendBool(data, true)
+	}
+
+	source := bytes.NewReader(data)
+	reader := bufio.NewReader(source)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		source.Reset(data)
+		reader.Reset(source)
+		for {
+			if _, err := ReadNextPacket(reader); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -20,3 +20,7 @@ func IAbs(i int) int {
 	}
 	return i
 }
+
+func IClamp(i, min, max int) int {
+	return IMax(min, IMin(i, max))
+}
@@ -5,3 +5,7 @@ type ItemStack struct {
 	Damage uint16
 	Count  byte
 }
+
+func (stack *ItemStack) IsEmpty() bool {
+	return stack.Id == 0 || stack.Count == 0
+}
@@ -0,0 +1,152 @@
+package oneworld
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/richgrov/oneworld/nbt"
+)
+
+// Version of the level format used by Beta 1.3 through 1.7.3
+const levelVersion = 19132
+
+// Layout of the level.dat file written by the vanilla server. Tags other than
+// these are ignored, so they aren't kept when the file is saved again.
+type levelFile struct {
+	Data levelData
+}
+
+type levelData struct {
+	RandomSeed int64
+	SpawnX     int32
+	SpawnY     int32
+	SpawnZ     int32
+	Time       int64
+	LastPlayed int64
+	LevelName  string
+	Version    int32 `nbt:"version"`
+
+	RainTime    int32 `nbt:"rainTime"`
+	Raining     byte  `nbt:"raining"`
+	ThunderTime int32 `nbt:"thunderTime"`
+	Thundering  byte  `nbt:"thundering"`
+}
+
+// Sets the level.dat file the world's state is saved to and loads it if it
+// exists. The level isn't saved if the path is empty.
+func (server *Server) SetLevelFile(path string) error {
+	server.levelPath = path
+	if path == "" {
+		return nil
+	}
+
+	var file levelFile
+	found, err := readCompressedNBT(path, &file)
+	if err != nil || !found {
+		return err
+	}
+
+	server.level = file.Data
+	server.time = file.Data.Time
+	server.weather = weatherState{
+		raining:      file.Data.Raining != 0,
+		rainTicks:    file.Data.RainTime,
+		thundering:   file.Data.Thundering != 0,
+		thunderTicks: file.Data.ThunderTime,
+	}
+	return nil
+}
+
+// Writes the world's state to its level file if one is set
+func (server *Server) SaveLevel() error {
+	if server.levelPath == "" {
+		return nil
+	}
+
+	server.level.Time = server.time
+	server.level.RainTime = server.weather.rainTicks
+	server.level.Raining = boolByte(server.weather.raining)
+	server.level.ThunderTime = server.weather.thunderTicks
+	server.level.Thundering = boolByte(server.weather.thundering)
+	server.level.LastPlayed = time.Now().UnixMilli()
+	server.level.Version = levelVersion
+	return writeCompressedNBT(server.levelPath, levelFile{Data: server.level})
+}
+
+// Saves the level and every player. Everything is still saved if one part
+// fails, and the first error is returned.
+func (server *Server) Save() error {
+	levelErr := server.SaveLevel()
+	if err := server.SavePlayers(); err != nil && levelErr == nil {
+		return err
+	}
+	return levelErr
+}
+
+// NBT has no boolean type, so they're stored as bytes
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Reads a gzip-compressed NBT file into v. Returns false if the file doesn't
+// exist.
+func readCompressedNBT(path string, v any) (bool, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	decompressor, err := gzip.NewReader(file)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := nbt.Unmarshal(bufio.NewReader(decompressor), v); err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Writes v to a gzip-compressed NBT file, creating its directory if needed. The
+// file is replaced atomically so that a failed write doesn't corrupt it.
+func writeCompressedNBT(path string, v any) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	compressor := gzip.NewWriter(file)
+	if err := nbt.Marshal(v, "", compressor); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,92 @@
+package oneworld
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+func TestTimeRate(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	server := player.Server
+	server.AddEntity(player)
+
+	server.SetTime(1000)
+	server.Tick()
+	if server.Time() != 1001 {
+		t.Fatalf("time advanced to %d", server.Time())
+	}
+
+	server.SetTimeRate(0)
+	server.Tick()
+	if server.Time() != 1001 {
+		t.Fatalf("frozen time advanced to %d", server.Time())
+	}
+
+	server.SetTimeRate(10)
+	server.Tick()
+	if server.Time() != 1011 {
+		t.Fatalf("time advanced to %d", server.Time())
+	}
+}
+
+func TestTimeSync(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	server := player.Server
+	server.AddEntity(player)
+	// Discard the time sent on spawning
+	queuedPackets(player)
+
+	synced := 0
+	for i := 0; i < timeSyncInterval*3; i++ {
+		server.Tick()
+		for _, packet := range queuedPackets(player) {
+			if packet[0] == protocol.TimeUpdateId {
+				synced++
+			}
+		}
+	}
+
+	if synced != 3 {
+		t.Fatalf("time was synced %d times", synced)
+	}
+}
+
+func TestSaveAndLoadLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "level.dat")
+	server := newEmptyServer(t)
+	if err := server.SetLevelFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	server.level.RandomSeed = 1234
+	server.SetTime(18000)
+	server.SetWeather(WeatherThunder, 500)
+	if err := server.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newEmptyServer(t)
+	if err := loaded.SetLevelFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Time() != 18000 || loaded.level.RandomSeed != 1234 || loaded.level.Version != levelVersion {
+		t.Fatalf("loaded time %d, seed %d, and version %d", loaded.Time(), loaded.level.RandomSeed, loaded.level.Version)
+	}
+
+	if loaded.Weather() != WeatherThunder || loaded.weather.rainTicks != 500 {
+		t.Fatalf("loaded weather %d with %d ticks left", loaded.Weather(), loaded.weather.rainTicks)
+	}
+}
+
+func newEmptyServer(t *testing.T) *Server {
+	server, err := NewServer(1, []*Chunk{new(Chunk)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+	return server
+}
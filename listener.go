@@ -2,21 +2,61 @@ package oneworld
 
 import (
 	"bufio"
+	"context"
 	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/richgrov/oneworld/internal/protocol"
 )
 
+// How long a client has to log in before its connection is closed
+const loginTimeout = 30 * time.Second
+
 type Listener struct {
 	listener            net.Listener
 	acceptedConnections chan *AcceptedConnection
+
+	// Guards the callbacks, which can be changed while connections are being
+	// accepted, and the lifecycle state below
+	mu          sync.Mutex
+	statusFunc  func() ServerStatus
+	loginFilter LoginFilter
+	sessionURL  string
+
+	httpClient   *http.Client
+	loginTimeout time.Duration
+
+	// Connections that are still logging in
+	pending map[net.Conn]struct{}
+	// Goroutines handling the pending connections
+	group    sync.WaitGroup
+	shutdown bool
+	// Whether Run has started. runDone is closed once it returns.
+	running bool
+	runDone chan struct{}
+	// Cancels requests to the session server on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Information shown for the server in the client's server list
+type ServerStatus struct {
+	Motd          string
+	OnlinePlayers int
+	MaxPlayers    int
 }
 
 type AcceptedConnection struct {
 	Username string
 	reader   *bufio.Reader
 	conn     net.Conn
+	// Lets the login filter release what it reserved for the player
+	releaseLogin func()
 }
 
 func NewListener(address string) (*Listener, error) {
@@ -25,13 +65,32 @@ func NewListener(address string) (*Listener, error) {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Listener{
 		listener:            listener,
 		acceptedConnections: make(chan *AcceptedConnection, 16),
+		httpClient:          &http.Client{Timeout: authTimeout},
+		loginTimeout:        loginTimeout,
+
+		pending: make(map[net.Conn]struct{}),
+		runDone: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
 	}, nil
 }
 
+// Accepts connections until the listener is closed. Shutdown waits for it to
+// return.
 func (listener *Listener) Run() {
+	listener.mu.Lock()
+	if listener.shutdown || listener.running {
+		listener.mu.Unlock()
+		return
+	}
+	listener.running = true
+	listener.mu.Unlock()
+	defer close(listener.runDone)
+
 	for {
 		conn, err := listener.listener.Accept()
 		if errors.Is(err, net.ErrClosed) {
@@ -40,21 +99,117 @@ func (listener *Listener) Run() {
 			continue
 		}
 
-		go listener.accept(conn)
+		listener.mu.Lock()
+		if listener.shutdown {
+			listener.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		listener.pending[conn] = struct{}{}
+		listener.group.Add(1)
+		listener.mu.Unlock()
+
+		go func() {
+			defer listener.group.Done()
+			if err := listener.accept(conn); err != nil {
+				conn.Close()
+			}
+
+			listener.mu.Lock()
+			delete(listener.pending, conn)
+			listener.mu.Unlock()
+		}()
+	}
+}
+
+// Sets the function called to describe the server when a client pings it from
+// the server list. It's called from the listener's goroutines, so it must be
+// safe to call concurrently with the tick loop.
+func (listener *Listener) SetStatusFunc(statusFunc func() ServerStatus) {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	listener.statusFunc = statusFunc
+}
+
+func (listener *Listener) status() ServerStatus {
+	listener.mu.Lock()
+	statusFunc := listener.statusFunc
+	listener.mu.Unlock()
+
+	if statusFunc == nil {
+		return ServerStatus{}
 	}
+	return statusFunc()
+}
+
+// Sets the filter that decides which players may join. Players refused by it
+// are kicked with the reason it gives. A nil filter allows everyone.
+func (listener *Listener) SetLoginFilter(filter LoginFilter) {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	listener.loginFilter = filter
+}
+
+// Returns a function that releases what the filter reserved for the login, or
+// nil if it doesn't reserve anything
+func (listener *Listener) checkLogin(username string, addr net.Addr) (func(), error) {
+	listener.mu.Lock()
+	filter := listener.loginFilter
+	listener.mu.Unlock()
+
+	if filter == nil {
+		return nil, nil
+	}
+
+	var ip net.IP
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip = tcpAddr.IP
+	}
+	if err := filter.CheckLogin(username, ip); err != nil {
+		return nil, err
+	}
+
+	if releaser, ok := filter.(LoginReleaser); ok {
+		return func() { releaser.ReleaseLogin(username) }, nil
+	}
+	return nil, nil
 }
 
 func (listener *Listener) accept(conn net.Conn) error {
 	reader := bufio.NewReader(conn)
 
+	// Otherwise a client that never sends anything would keep the goroutine
+	// running forever
+	if err := conn.SetReadDeadline(time.Now().Add(listener.loginTimeout)); err != nil {
+		return err
+	}
+
+	if id, err := reader.Peek(1); err != nil {
+		conn.Close()
+		return err
+	} else if id[0] == protocol.ServerListPingId {
+		defer conn.Close()
+		return listener.respondToPing(conn)
+	}
+
 	var handshake protocol.HandshakePacket
 	if err := protocol.ExpectPacket(reader, protocol.HandshakeId, &handshake); err != nil {
 		return err
 	}
 
-	// Legacy auth is no longer supported, so servers always respond with
-	// offline mode handshake, which is "-" for the username.
-	handshakeResponse := &protocol.HandshakePacket{Username: "-"}
+	// The username field of the response is the server ID. Checked once so
+	// that the login is verified the same way the handshake was answered.
+	sessionURL := listener.sessionServer()
+	serverId := "-"
+	if sessionURL != "" {
+		id, err := newServerId()
+		if err != nil {
+			return err
+		}
+		serverId = id
+	}
+
+	handshakeResponse := &protocol.HandshakePacket{Username: serverId}
 	if _, err := conn.Write(handshakeResponse.Marshal()); err != nil {
 		return err
 	}
@@ -64,20 +219,76 @@ func (listener *Listener) accept(conn net.Conn) error {
 		return err
 	}
 
-	if login.ProtocolVersion != protocolVersion {
-		return errors.New("invalid protocol version")
+	if login.ProtocolVersion > protocolVersion {
+		return kick(conn, "Outdated server!")
+	} else if login.ProtocolVersion < protocolVersion {
+		return kick(conn, "Outdated client!")
 	}
 
 	if handshake.Username != login.Username {
-		return errors.New("username mismatch")
+		return kick(conn, "Your username doesn't match the one you connected with")
+	}
+
+	if sessionURL != "" {
+		if err := listener.verifyUsername(sessionURL, login.Username, serverId); err != nil {
+			kick(conn, "Failed to verify username!")
+			return err
+		}
+	}
+
+	// Players may go longer than the timeout without sending anything
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	release, err := listener.checkLogin(login.Username, conn.RemoteAddr())
+	if err != nil {
+		return kick(conn, err.Error())
 	}
 
-	listener.acceptedConnections <- &AcceptedConnection{
-		Username: handshake.Username,
-		reader:   reader,
-		conn:     conn,
+	accepted := &AcceptedConnection{
+		Username:     handshake.Username,
+		reader:       reader,
+		conn:         conn,
+		releaseLogin: release,
+	}
+
+	select {
+	case listener.acceptedConnections <- accepted:
+		return nil
+	case <-listener.ctx.Done():
+		accepted.release()
+		return kick(conn, shutdownMessage)
+	}
+}
+
+// Releases what the login filter reserved for the player, if anything. Only
+// the first call does anything.
+func (accepted *AcceptedConnection) release() {
+	if accepted.releaseLogin != nil {
+		accepted.releaseLogin()
+		accepted.releaseLogin = nil
 	}
-	return nil
+}
+
+// Sends the reason to a connection that hasn't been accepted. Always returns a
+// non-nil error so that the connection is closed.
+func kick(conn net.Conn, reason string) error {
+	if _, err := conn.Write(protocol.NewKick(reason).Marshal()); err != nil {
+		return err
+	}
+	return fmt.Errorf("kicked: %s", reason)
+}
+
+// Replies with the server's status in the format "motd§online§max"
+func (listener *Listener) respondToPing(conn net.Conn) error {
+	status := listener.status()
+	// The separator can't appear in the MOTD without breaking the format
+	motd := strings.ReplaceAll(status.Motd, "§", "")
+
+	response := protocol.NewServerListResponse(motd, status.OnlinePlayers, status.MaxPlayers)
+	_, err := conn.Write(response.Marshal())
+	return err
 }
 
 func (listener *Listener) Dequeue() *AcceptedConnection {
@@ -89,6 +300,52 @@ func (listener *Listener) Dequeue() *AcceptedConnection {
 	}
 }
 
+// Stops accepting new connections. Connections that are logging in are left
+// to finish.
 func (listener *Listener) Close() error {
 	return listener.listener.Close()
 }
+
+// Stops accepting connections and closes those that are still logging in.
+// Players that logged in but haven't been dequeued are kicked. Blocks until
+// Run has returned and every goroutine started by the listener has stopped. If
+// the context is done first, its error is returned without waiting further.
+func (listener *Listener) Shutdown(ctx context.Context) error {
+	closeErr := listener.Close()
+	if errors.Is(closeErr, net.ErrClosed) {
+		closeErr = nil
+	}
+
+	listener.mu.Lock()
+	listener.shutdown = true
+	running := listener.running
+	for conn := range listener.pending {
+		conn.Close()
+	}
+	listener.mu.Unlock()
+	listener.cancel()
+
+	// Run adds to the group, so it has to return before the group is waited on
+	if running {
+		select {
+		case <-listener.runDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := waitForGoroutines(ctx, &listener.group, func() {}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case accepted := <-listener.acceptedConnections:
+			accepted.release()
+			kick(accepted.conn, shutdownMessage)
+			accepted.conn.Close()
+		default:
+			return closeErr
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package oneworld
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+// Starts a listener on a random local port
+func newTestListener(t *testing.T) *Listener {
+	listener, err := NewListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go listener.Run()
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+type testConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (conn *testConn) write(t *testing.T, data ...[]byte) {
+	t.Helper()
+	for _, d := range data {
+		if _, err := conn.conn.Write(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Connects to the listener and sends the bytes
+func dialListener(t *testing.T, listener *Listener, data ...[]byte) *testConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", listener.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	test := &testConn{conn: conn, reader: bufio.NewReader(conn)}
+	test.write(t, data...)
+	return test
+}
+
+// Waits for the listener to accept a connection
+func waitForConnection(t *testing.T, listener *Listener) *AcceptedConnection {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if conn := listener.Dequeue(); conn != nil {
+			return conn
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatal("no connection was accepted")
+	return nil
+}
+
+// Reads the message of the disconnect packet the listener replied with
+func expectKick(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	var kick protocol.DisconnectPacket
+	if err := protocol.ExpectPacket(reader, protocol.DisconnectId, &kick); err != nil {
+		t.Fatal(err)
+	}
+	return kick.Message
+}
+
+func TestServerListPing(t *testing.T) {
+	listener := newTestListener(t)
+	listener.SetStatusFunc(func() ServerStatus {
+		return ServerStatus{Motd: "A §cserver", OnlinePlayers: 3, MaxPlayers: 20}
+	})
+
+	conn := dialListener(t, listener, []byte{protocol.ServerListPingId})
+	if message := expectKick(t, conn.reader); message != "A cserver§3§20" {
+		t.Fatalf("got status %q", message)
+	}
+}
+
+func TestServerListPingLongMotd(t *testing.T) {
+	listener := newTestListener(t)
+	listener.SetStatusFunc(func() ServerStatus {
+		return ServerStatus{Motd: strings.Repeat("a", 150), OnlinePlayers: 3, MaxPlayers: 20}
+	})
+
+	// The MOTD is shortened so that the counts still fit
+	conn := dialListener(t, listener, []byte{protocol.ServerListPingId})
+	if message := expectKick(t, conn.reader); message != strings.Repeat("a", 95)+"§3§20" {
+		t.Fatalf("got status %q", message)
+	}
+}
+
+func TestKickOutdatedClient(t *testing.T) {
+	listener := newTestListener(t)
+
+	handshake := &protocol.HandshakePacket{Username: "Notch"}
+	login := &protocol.LoginPacket{ProtocolVersion: protocolVersion - 1, Username: "Notch"}
+	conn := dialListener(t, listener, handshake.Marshal(), login.Marshal())
+
+	var response protocol.HandshakePacket
+	if err := protocol.ExpectPacket(conn.reader, protocol.HandshakeId, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if message := expectKick(t, conn.reader); message != "Outdated client!" {
+		t.Fatalf("kicked for %q", message)
+	}
+}
+
+func TestKickUsernameMismatch(t *testing.T) {
+	listener := newTestListener(t)
+
+	handshake := &protocol.HandshakePacket{Username: "Notch"}
+	login := &protocol.LoginPacket{ProtocolVersion: protocolVersion, Username: "jeb_"}
+	conn := dialListener(t, listener, handshake.Marshal(), login.Marshal())
+
+	var response protocol.HandshakePacket
+	if err := protocol.ExpectPacket(conn.reader, protocol.HandshakeId, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	expectKick(t, conn.reader)
+	if listener.Dequeue() != nil {
+		t.Fatal("connection was accepted")
+	}
+}
+
+func TestLoginTimeout(t *testing.T) {
+	listener, err := NewListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.loginTimeout = 50 * time.Millisecond
+	go listener.Run()
+	t.Cleanup(func() { listener.Close() })
+
+	// Never sends anything
+	idle := dialListener(t, listener)
+	idle.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := idle.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("connection wasn't closed: %v", err)
+	}
+
+	handshake := &protocol.HandshakePacket{Username: "Notch"}
+	login := &protocol.LoginPacket{ProtocolVersion: protocolVersion, Username: "Notch"}
+	client := dialListener(t, listener, handshake.Marshal(), login.Marshal())
+	accepted := waitForConnection(t, listener)
+
+	// The timeout no longer applies once the player has logged in
+	time.Sleep(100 * time.Millisecond)
+	client.write(t, (&protocol.KeepAlivePacket{}).Marshal())
+	if _, err := protocol.ReadNextPacket(accepted.reader); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerShutdown(t *testing.T) {
+	listener := newTestListener(t)
+	// Never finishes logging in
+	conn := dialListener(t, listener)
+
+	// Wait for the connection to be accepted
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		listener.mu.Lock()
+		pending := len(listener.pending)
+		listener.mu.Unlock()
+
+		if pending == 1 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("connection wasn't accepted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := listener.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("connection wasn't closed: %v", err)
+	}
+}
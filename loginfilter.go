@@ -0,0 +1,367 @@
+package oneworld
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Decides whether a player may join after they've logged in. The error's
+// message is shown to players who are refused. Filters are called from the
+// listener's goroutines, so they must be safe to call concurrently.
+type LoginFilter interface {
+	CheckLogin(username string, ip net.IP) error
+}
+
+type LoginFilterFunc func(username string, ip net.IP) error
+
+func (f LoginFilterFunc) CheckLogin(username string, ip net.IP) error {
+	return f(username, ip)
+}
+
+// Implemented by filters that hold something for each login they allow, such
+// as a slot on a full server. ReleaseLogin is called once the player has been
+// added to a world, or if their login fails after the filter allowed it.
+type LoginReleaser interface {
+	ReleaseLogin(username string)
+}
+
+// Combines the filters into one that refuses a login if any of them do
+func LoginFilters(filters ...LoginFilter) LoginFilter {
+	return loginFilters(filters)
+}
+
+type loginFilters []LoginFilter
+
+func (filters loginFilters) CheckLogin(username string, ip net.IP) error {
+	for i, filter := range filters {
+		if err := filter.CheckLogin(username, ip); err != nil {
+			// The filters that allowed the login won't see it finish
+			releaseLogin(filters[:i], username)
+			return err
+		}
+	}
+	return nil
+}
+
+func (filters loginFilters) ReleaseLogin(username string) {
+	releaseLogin(filters, username)
+}
+
+func releaseLogin(filters []LoginFilter, username string) {
+	for _, filter := range filters {
+		if releaser, ok := filter.(LoginReleaser); ok {
+			releaser.ReleaseLogin(username)
+		}
+	}
+}
+
+// Only allows players on the list to join
+func Whitelist(list *NameList) LoginFilter {
+	return LoginFilterFunc(func(username string, _ net.IP) error {
+		if !list.Contains(username) {
+			return errors.New("You are not white-listed on this server!")
+		}
+		return nil
+	})
+}
+
+// Refuses players on the list
+func BannedNames(list *NameList) LoginFilter {
+	return LoginFilterFunc(func(username string, _ net.IP) error {
+		if list.Contains(username) {
+			return errors.New("You are banned from this server!")
+		}
+		return nil
+	})
+}
+
+// Refuses players connecting from an address on the list
+func BannedIPs(list *IPList) LoginFilter {
+	return LoginFilterFunc(func(_ string, ip net.IP) error {
+		if list.Contains(ip) {
+			return errors.New("Your IP address is banned from this server!")
+		}
+		return nil
+	})
+}
+
+// Refuses players once online returns max or more. Players who are let in
+// keep their slot until they're added to a world, so players logging in at the
+// same time can't go over the limit. online must be safe to call concurrently
+// with the tick loop.
+func MaxPlayers(max int, online func() int) LoginFilter {
+	return &playerLimit{max: max, online: online}
+}
+
+type playerLimit struct {
+	max    int
+	online func() int
+
+	mu sync.Mutex
+	// Players who were let in but haven't been added to a world yet
+	joining int
+}
+
+func (limit *playerLimit) CheckLogin(string, net.IP) error {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+
+	if limit.online()+limit.joining >= limit.max {
+		return errors.New("The server is full!")
+	}
+	limit.joining++
+	return nil
+}
+
+func (limit *playerLimit) ReleaseLogin(string) {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	limit.joining--
+}
+
+// A set of usernames stored in a text file with one name per line, such as
+// the white-list.txt and banned-players.txt files of the vanilla server. Names
+// are case insensitive. Changes are saved to the file immediately.
+type NameList struct {
+	mu    sync.RWMutex
+	path  string
+	names map[string]bool
+}
+
+// Loads the list from the file. The file is created when the list is first
+// changed if it doesn't exist.
+func LoadNameList(path string) (*NameList, error) {
+	list := &NameList{path: path}
+	if err := list.Reload(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Reads the file again to pick up changes made outside of the program
+func (list *NameList) Reload() error {
+	lines, err := readListFile(list.path)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		names[strings.ToLower(line)] = true
+	}
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	list.names = names
+	return nil
+}
+
+func (list *NameList) Contains(username string) bool {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	return list.names[strings.ToLower(username)]
+}
+
+func (list *NameList) Add(username string) error {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	list.names[strings.ToLower(username)] = true
+	return list.save()
+}
+
+func (list *NameList) Remove(username string) error {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	delete(list.names, strings.ToLower(username))
+	return list.save()
+}
+
+// Returns the names on the list in alphabetical order
+func (list *NameList) Names() []string {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	names := make([]string, 0, len(list.names))
+	for name := range list.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Must be called with the lock held
+func (list *NameList) save() error {
+	names := make([]string, 0, len(list.names))
+	for name := range list.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return writeListFile(list.path, names)
+}
+
+// A list of IP addresses and CIDR ranges stored in a text file with one entry
+// per line, such as the banned-ips.txt file of the vanilla server. Changes are
+// saved to the file immediately.
+type IPList struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[string]*net.IPNet
+}
+
+// Loads the list from the file. The file is created when the list is first
+// changed if it doesn't exist.
+func LoadIPList(path string) (*IPList, error) {
+	list := &IPList{path: path}
+	if err := list.Reload(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Reads the file again to pick up changes made outside of the program
+func (list *IPList) Reload() error {
+	lines, err := readListFile(list.path)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]*net.IPNet, len(lines))
+	for _, line := range lines {
+		network, err := parseIPEntry(line)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", list.path, err)
+		}
+		entries[line] = network
+	}
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	list.entries = entries
+	return nil
+}
+
+// Parses a single address, which is treated as a range containing only
+// itself, or a range in CIDR notation such as 192.168.0.0/16
+func parseIPEntry(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		return network, err
+	}
+
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", entry)
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Whether the address is on the list or inside one of its ranges
+func (list *IPList) Contains(ip net.IP) bool {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	for _, network := range list.entries {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds an address or CIDR range to the list
+func (list *IPList) Add(entry string) error {
+	network, err := parseIPEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	list.entries[entry] = network
+	return list.save()
+}
+
+// Removes an entry exactly as it was added. Addresses inside a range can't be
+// removed on their own.
+func (list *IPList) Remove(entry string) error {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	delete(list.entries, entry)
+	return list.save()
+}
+
+// Must be called with the lock held
+func (list *IPList) save() error {
+	entries := make([]string, 0, len(list.entries))
+	for entry := range list.entries {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return writeListFile(list.path, entries)
+}
+
+// Returns the non-empty lines of the file, or nothing if it doesn't exist.
+// Lines starting with # are comments.
+func readListFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// Replaces the file atomically with one containing the lines
+func writeListFile(path string, lines []string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	writer := bufio.NewWriter(file)
+	for _, line := range lines {
+		writer.WriteString(line)
+		writer.WriteByte('\n')
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
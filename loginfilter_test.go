@@ -0,0 +1,223 @@
+package oneworld
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+func TestNameList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banned-players.txt")
+	if err := os.WriteFile(path, []byte("Notch\n\n# comment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadNameList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !list.Contains("notch") || list.Contains("jeb_") {
+		t.Fatalf("loaded %v", list.Names())
+	}
+
+	if err := list.Add("jeb_"); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Remove("NOTCH"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadNameList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := reloaded.Names(); len(names) != 1 || names[0] != "jeb_" {
+		t.Fatalf("saved %v", names)
+	}
+}
+
+func TestIPList(t *testing.T) {
+	list, err := LoadIPList(filepath.Join(t.TempDir(), "banned-ips.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := list.Add("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Add("192.168.1.5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Add("not an address"); err == nil {
+		t.Fatal("added invalid entry")
+	}
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.20.30.40", true},
+		{"11.0.0.1", false},
+		{"192.168.1.5", true},
+		{"192.168.1.6", false},
+		{"::ffff:192.168.1.5", true},
+	}
+
+	for _, test := range tests {
+		if actual := list.Contains(net.ParseIP(test.ip)); actual != test.expected {
+			t.Errorf("%s: expected %v but got %v", test.ip, test.expected, actual)
+		}
+	}
+}
+
+func TestLoginFilters(t *testing.T) {
+	dir := t.TempDir()
+	whitelist, _ := LoadNameList(filepath.Join(dir, "white-list.txt"))
+	whitelist.Add("Notch")
+	whitelist.Add("jeb_")
+	bans, _ := LoadNameList(filepath.Join(dir, "banned-players.txt"))
+	bans.Add("jeb_")
+
+	online := 0
+	filter := LoginFilters(Whitelist(whitelist), BannedNames(bans), MaxPlayers(1, func() int { return online }))
+	localhost := net.IPv4(127, 0, 0, 1)
+
+	if err := filter.CheckLogin("Notch", localhost); err != nil {
+		t.Errorf("whitelisted player was refused: %s", err)
+	}
+	if err := filter.CheckLogin("Dinnerbone", localhost); err == nil {
+		t.Error("player who isn't whitelisted joined")
+	}
+	if err := filter.CheckLogin("jeb_", localhost); err == nil {
+		t.Error("banned player joined")
+	}
+
+	online = 1
+	if err := filter.CheckLogin("Notch", localhost); err == nil {
+		t.Error("player joined full server")
+	}
+}
+
+func TestMaxPlayersConcurrentLogins(t *testing.T) {
+	filter := MaxPlayers(5, func() int { return 0 })
+
+	var group sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 50; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if filter.CheckLogin("Notch", nil) == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	group.Wait()
+
+	if allowed.Load() != 5 {
+		t.Fatalf("allowed %d players", allowed.Load())
+	}
+
+	filter.(LoginReleaser).ReleaseLogin("Notch")
+	if err := filter.CheckLogin("Notch", nil); err != nil {
+		t.Fatalf("slot wasn't released: %s", err)
+	}
+}
+
+func TestRefusedLoginReleasesSlot(t *testing.T) {
+	bans, _ := LoadNameList(filepath.Join(t.TempDir(), "banned-players.txt"))
+	bans.Add("jeb_")
+	filter := LoginFilters(MaxPlayers(1, func() int { return 0 }), BannedNames(bans))
+
+	if err := filter.CheckLogin("jeb_", nil); err == nil {
+		t.Fatal("banned player joined")
+	}
+	if err := filter.CheckLogin("Notch", nil); err != nil {
+		t.Fatalf("slot of refused player wasn't released: %s", err)
+	}
+}
+
+// Logs in through the listener and returns the message the player was kicked
+// with, or an empty string if they weren't
+func loginToListener(t *testing.T, listener *Listener, username string) string {
+	t.Helper()
+	handshake := &protocol.HandshakePacket{Username: username}
+	login := &protocol.LoginPacket{ProtocolVersion: protocolVersion, Username: username}
+	conn := dialListener(t, listener, handshake.Marshal(), login.Marshal())
+
+	var response protocol.HandshakePacket
+	if err := protocol.ExpectPacket(conn.reader, protocol.HandshakeId, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	kicked := make(chan string, 1)
+	go func() {
+		var kick protocol.DisconnectPacket
+		if err := protocol.ExpectPacket(conn.reader, protocol.DisconnectId, &kick); err == nil {
+			kicked <- kick.Message
+		}
+	}()
+
+	select {
+	case message := <-kicked:
+		return message
+	case <-time.After(100 * time.Millisecond):
+		return ""
+	}
+}
+
+func TestSlotHeldUntilSpawned(t *testing.T) {
+	server := newEmptyServer(t)
+	listener := newTestListener(t)
+	listener.SetLoginFilter(MaxPlayers(1, server.OnlinePlayers))
+
+	if message := loginToListener(t, listener, "Notch"); message != "" {
+		t.Fatalf("kicked for %q", message)
+	}
+	accepted := waitForConnection(t, listener)
+
+	// Notch hasn't been added to the world yet
+	if message := loginToListener(t, listener, "jeb_"); message != "The server is full!" {
+		t.Fatalf("kicked for %q", message)
+	}
+
+	base := NewBasePlayer(server.AllocateEntity(8.5, 20, 8.5), server, accepted, 1, 0, Overworld, new(violationRecorder))
+	player := &base
+	player.loopsPending = false
+	server.AddEntity(player)
+	if message := loginToListener(t, listener, "jeb_"); message != "The server is full!" {
+		t.Fatalf("kicked for %q", message)
+	}
+
+	server.RemoveEntity(player.Id())
+	if message := loginToListener(t, listener, "jeb_"); message != "" {
+		t.Fatalf("kicked for %q after Notch left", message)
+	}
+}
+
+func TestListenerKicksBannedIP(t *testing.T) {
+	listener := newTestListener(t)
+	bans, _ := LoadIPList(filepath.Join(t.TempDir(), "banned-ips.txt"))
+	bans.Add("127.0.0.0/8")
+	listener.SetLoginFilter(BannedIPs(bans))
+
+	handshake := &protocol.HandshakePacket{Username: "Notch"}
+	login := &protocol.LoginPacket{ProtocolVersion: protocolVersion, Username: "Notch"}
+	conn := dialListener(t, listener, handshake.Marshal(), login.Marshal())
+
+	var response protocol.HandshakePacket
+	if err := protocol.ExpectPacket(conn.reader, protocol.HandshakeId, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if message := expectKick(t, conn.reader); message != "Your IP address is banned from this server!" {
+		t.Fatalf("kicked for %q", message)
+	}
+}
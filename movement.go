@@ -0,0 +1,243 @@
+package oneworld
+
+import (
+	"math"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/geom"
+)
+
+// How far a player's hitbox may overlap blocks before it's considered inside
+// of them. Accounts for rounding errors on the client.
+const collisionTolerance = 0.0625
+
+// Number of position updates after being knocked back during which speed and
+// flight aren't checked
+const knockbackGraceUpdates = 20
+
+// Coordinates beyond this are rejected, as done by the vanilla server
+const maxCoordinate = 3.2e7
+
+type Violation int
+
+const (
+	// The player moved further than allowed in one update
+	ViolationSpeed Violation = iota
+	// The player rose or stayed in the air without anything to climb or swim in
+	ViolationFlight
+	// The distance between the player's feet and eyes wasn't valid
+	ViolationStance
+	// The player moved into or through a solid block
+	ViolationCollision
+	// The player sent a position that was out of range or not a number
+	ViolationInvalidPosition
+	// The player finished breaking a block sooner than possible
+	ViolationDigSpeed
+	// The player interacted with a block too far away from them
+	ViolationReach
+	// The player interacted with a block hidden behind other blocks
+	ViolationLineOfSight
+)
+
+func (violation Violation) String() string {
+	switch violation {
+	case ViolationSpeed:
+		return "moved too quickly"
+	case ViolationFlight:
+		return "flying"
+	case ViolationStance:
+		return "illegal stance"
+	case ViolationCollision:
+		return "moved into a block"
+	case ViolationInvalidPosition:
+		return "invalid position"
+	case ViolationDigSpeed:
+		return "broke a block too quickly"
+	case ViolationReach:
+		return "reached too far"
+	case ViolationLineOfSight:
+		return "interacted through a block"
+	default:
+		return "unknown violation"
+	}
+}
+
+// Limits on how players may move. Setting a field to its zero value disables
+// the check.
+type MovementChecks struct {
+	// Maximum horizontal distance a player can move in one position update
+	MaxHorizontalSpeed float64
+	// Maximum distance a player can rise above the point where they last left
+	// the ground
+	MaxJumpHeight float64
+	// Maximum number of consecutive updates a player can spend in the air
+	// without falling
+	MaxHoverUpdates int
+	// Allowed range of the distance between the player's Y and the stance
+	// they report
+	MinStance float64
+	MaxStance float64
+	// Whether to prevent players from moving into or through solid blocks
+	CheckCollision bool
+}
+
+var DefaultMovementChecks = MovementChecks{
+	MaxHorizontalSpeed: 1,
+	MaxJumpHeight:      1.3,
+	MaxHoverUpdates:    10,
+	MinStance:          0.1,
+	MaxStance:          1.65,
+	CheckCollision:     true,
+}
+
+// State needed to check consecutive movements
+type movementState struct {
+	checks MovementChecks
+	// When true, movement is ignored until the client confirms a position
+	// sent by the server
+	awaitingTeleport bool
+	knockbackGrace   int
+
+	onGround     bool
+	airborne     bool
+	airborneY    float64
+	hoverUpdates int
+}
+
+func (player *PlayerBase[S]) SetMovementChecks(checks MovementChecks) {
+	player.movement.checks = checks
+}
+
+// Validates a position sent by the client and either accepts it or sends the
+// player back to their last valid position
+func (player *PlayerBase[S]) handleMovement(x, y, stance, z float64) {
+	if player.movement.awaitingTeleport {
+		dy := y - player.y
+		if x == player.x && z == player.z && dy*dy < 0.01 {
+			player.movement.awaitingTeleport = false
+		}
+		return
+	}
+
+	if violation, ok := player.checkMovement(x, y, stance, z); !ok {
+		player.sendPosition()
+		player.eventHandler.OnViolation(violation)
+		return
+	}
+
+	player.move(x, y, z)
+	player.movement.onGround = player.standingOnBlock(geom.Vec3{X: x, Y: y, Z: z})
+}
+
+func (player *PlayerBase[S]) checkMovement(x, y, stance, z float64) (Violation, bool) {
+	for _, coord := range [...]float64{x, y, stance, z} {
+		if math.IsNaN(coord) || math.Abs(coord) > maxCoordinate {
+			return ViolationInvalidPosition, false
+		}
+	}
+
+	checks := &player.movement.checks
+	if checks.MaxStance > 0 {
+		if diff := stance - y; diff < checks.MinStance || diff > checks.MaxStance {
+			return ViolationStance, false
+		}
+	}
+
+	newPos := geom.Vec3{X: x, Y: y, Z: z}
+	oldPos := geom.Vec3{X: player.x, Y: player.y, Z: player.z}
+	delta := newPos.Sub(oldPos)
+
+	if checks.CheckCollision && player.passesThroughBlocks(oldPos, newPos) {
+		return ViolationCollision, false
+	}
+
+	if player.movement.knockbackGrace > 0 {
+		player.movement.knockbackGrace--
+		player.movement.airborne = false
+		return 0, true
+	}
+
+	if max := checks.MaxHorizontalSpeed; max > 0 && delta.X*delta.X+delta.Z*delta.Z > max*max {
+		return ViolationSpeed, false
+	}
+
+	return player.checkFlight(newPos, delta.Y)
+}
+
+// Whether the player's hitbox ends up in a block, or the center of their body
+// moved through one
+func (player *PlayerBase[S]) passesThroughBlocks(oldPos, newPos geom.Vec3) bool {
+	oldBox := geom.EntityAABB(oldPos, entityWidth, entityHeight).Grow(-collisionTolerance)
+	if len(player.Server.BlockCollisions(oldBox)) > 0 {
+		// Already stuck, possibly because a block was placed on them. Let them
+		// move out.
+		return false
+	}
+
+	newBox := geom.EntityAABB(newPos, entityWidth, entityHeight).Grow(-collisionTolerance)
+	if len(player.Server.BlockCollisions(newBox)) > 0 {
+		return true
+	}
+
+	bodyOffset := geom.Vec3{Y: entityHeight / 2}
+	ray := geom.Ray{
+		Origin:    oldPos.Add(bodyOffset),
+		Direction: newPos.Sub(oldPos),
+	}
+	_, _, _, hit := player.Server.RaycastBlocks(ray, 1)
+	return hit
+}
+
+func (player *PlayerBase[S]) checkFlight(newPos geom.Vec3, dy float64) (Violation, bool) {
+	state := &player.movement
+	box := geom.EntityAABB(newPos, entityWidth, entityHeight)
+
+	if player.standingOnBlock(newPos) || player.canClimbOrSwim(box) {
+		state.airborne = false
+		return 0, true
+	}
+
+	if !state.airborne {
+		state.airborne = true
+		state.airborneY = player.y
+		state.hoverUpdates = 0
+	}
+
+	if max := state.checks.MaxJumpHeight; max > 0 && newPos.Y-state.airborneY > max {
+		return ViolationFlight, false
+	}
+
+	if dy >= 0 {
+		state.hoverUpdates++
+	} else {
+		state.hoverUpdates = 0
+	}
+
+	if max := state.checks.MaxHoverUpdates; max > 0 && state.hoverUpdates > max {
+		return ViolationFlight, false
+	}
+
+	return 0, true
+}
+
+// Whether the player would be standing on a block at the position
+func (player *PlayerBase[S]) standingOnBlock(pos geom.Vec3) bool {
+	feet := geom.EntityAABB(pos, entityWidth, entityHeight).Expand(geom.Vec3{Y: -0.1})
+	return len(player.Server.BlockCollisions(feet)) > 0
+}
+
+// Whether the box touches a block that allows players to move upwards without
+// standing on anything
+func (player *PlayerBase[S]) canClimbOrSwim(box geom.AABB) bool {
+	for x := int(math.Floor(box.Min.X)); x <= int(math.Floor(box.Max.X)); x++ {
+		for y := int(math.Floor(box.Min.Y)); y <= int(math.Floor(box.Max.Y)); y++ {
+			for z := int(math.Floor(box.Min.Z)); z <= int(math.Floor(box.Max.Z)); z++ {
+				switch player.Server.GetBlock(x, y, z).Type {
+				case blocks.Ladder, blocks.Water, blocks.FlowingWater, blocks.Lava, blocks.FlowingLava, blocks.Web:
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
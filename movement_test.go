@@ -0,0 +1,211 @@
+package oneworld
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+)
+
+const movementFloorY = 9
+
+type violationRecorder struct {
+	violations []Violation
+	digs       []digEvent
+	errors     []error
+}
+
+type digEvent struct {
+	pos      BlockPos
+	finished bool
+}
+
+func (*violationRecorder) OnChat(string)                                {}
+func (*violationRecorder) OnInteractBlock(int, int, int, int, int, int) {}
+func (*violationRecorder) OnInteractAir()                               {}
+func (*violationRecorder) OnHotbarChange(byte)                          {}
+func (*violationRecorder) OnSneak(bool)                                 {}
+func (*violationRecorder) OnSwingArm()                                  {}
+func (*violationRecorder) OnLeaveBed()                                  {}
+func (recorder *violationRecorder) OnDig(x, y, z int, finishedDestroying bool) {
+	recorder.digs = append(recorder.digs, digEvent{BlockPos{x, y, z}, finishedDestroying})
+}
+func (recorder *violationRecorder) OnViolation(violation Violation) {
+	recorder.violations = append(recorder.violations, violation)
+}
+func (recorder *violationRecorder) OnError(err error) {
+	recorder.errors = append(recorder.errors, err)
+}
+
+// Creates a player standing on a stone floor in the middle of a single chunk
+// world, with a stone wall at x = 10 and a ladder at x = 5
+func newMovementPlayer(t *testing.T) (*PlayerBase[*Server], *violationRecorder) {
+	chunk := new(Chunk)
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			chunk.Set(x, movementFloorY, z, blocks.Block{Type: blocks.Stone})
+			for y := movementFloorY + 1; y < movementFloorY+4; y++ {
+				chunk.Set(10, y, z, blocks.Block{Type: blocks.Stone})
+				chunk.Set(5, y, z, blocks.Block{Type: blocks.Ladder})
+			}
+		}
+	}
+
+	server, err := NewServer(1, []*Chunk{chunk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	recorder := new(violationRecorder)
+	return newTestPlayer(t, server, 8.5, movementFloorY+1, 8.5, recorder), recorder
+}
+
+// Creates a player in the world whose connection is never read from. Packets
+// are kept in the queue for tests to inspect.
+func newTestPlayer(t *testing.T, server *Server, x, y, z float64, eventHandler PlayerEventHandler) *PlayerBase[*Server] {
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+		clientConn.Close()
+	})
+	conn := &AcceptedConnection{
+		Username: "Notch",
+		reader:   bufio.NewReader(serverConn),
+		conn:     serverConn,
+	}
+
+	base := NewBasePlayer(server.AllocateEntity(x, y, z), server, conn, 1, 0, server.Dimension(), eventHandler)
+	player := &base
+	player.loopsPending = false
+	return player
+}
+
+// Removes and returns every packet waiting to be sent to the player, as if the
+// write loop had sent them
+func queuedPackets(player *PlayerBase[*Server]) [][]byte {
+	queue := player.outbound
+	queue.mu.Lock()
+	packets := queue.packets
+	queue.packets = make([][]byte, 0)
+	queue.waitingBytes = 0
+	queue.mu.Unlock()
+
+	queue.sent(packets)
+	return packets
+}
+
+// Sends a position from the client with a valid stance
+func sendMovement(player *PlayerBase[*Server], x, y, z float64) {
+	player.handleMovement(x, y, y+playerEyeHeight, z)
+}
+
+func expectViolation(t *testing.T, recorder *violationRecorder, expected Violation) {
+	t.Helper()
+	if len(recorder.violations) != 1 || recorder.violations[0] != expected {
+		t.Fatalf("expected violation %q but got %v", expected, recorder.violations)
+	}
+}
+
+func TestValidMovement(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+
+	for i := 1; i <= 10; i++ {
+		sendMovement(player, 8.5, movementFloorY+1, 8.5+float64(i)*0.2)
+	}
+
+	// Jump and land
+	for _, dy := range []float64{0.42, 0.75, 1.0, 1.17, 1.25, 1.2, 1.08, 0.9, 0.6, 0.2, 0} {
+		sendMovement(player, 8.5, movementFloorY+1+dy, 10.5)
+	}
+
+	if len(recorder.violations) != 0 {
+		t.Fatalf("unexpected violations %v", recorder.violations)
+	}
+
+	if _, y, z := player.Pos(); y != movementFloorY+1 || z != 10.5 {
+		t.Fatalf("player at y=%f z=%f", y, z)
+	}
+}
+
+func TestSpeedViolation(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+
+	sendMovement(player, 8.5, movementFloorY+1, 12)
+	expectViolation(t, recorder, ViolationSpeed)
+
+	if _, _, z := player.Pos(); z != 8.5 {
+		t.Fatalf("player wasn't moved back: z=%f", z)
+	}
+}
+
+func TestFlightViolation(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+
+	for i := 1; i <= 5 && len(recorder.violations) == 0; i++ {
+		sendMovement(player, 8.5, movementFloorY+1+float64(i)*0.4, 8.5)
+	}
+	expectViolation(t, recorder, ViolationFlight)
+}
+
+func TestHoverViolation(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+
+	sendMovement(player, 8.5, movementFloorY+2, 8.5)
+	for i := 0; i < DefaultMovementChecks.MaxHoverUpdates && len(recorder.violations) == 0; i++ {
+		sendMovement(player, 8.5, movementFloorY+2, 8.5+float64(i)*0.1)
+	}
+	expectViolation(t, recorder, ViolationFlight)
+}
+
+func TestClimbingLadder(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+	player.x = 5.5
+
+	for i := 1; i <= 20; i++ {
+		sendMovement(player, 5.5, movementFloorY+1+float64(i)*0.1, 8.5)
+	}
+
+	if len(recorder.violations) != 0 {
+		t.Fatalf("unexpected violations %v", recorder.violations)
+	}
+}
+
+func TestStanceViolation(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+
+	player.handleMovement(8.5, movementFloorY+1, movementFloorY+5, 8.6)
+	expectViolation(t, recorder, ViolationStance)
+}
+
+func TestCollisionViolation(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+	player.x = 9.6
+
+	sendMovement(player, 10.5, movementFloorY+1, 8.5)
+	expectViolation(t, recorder, ViolationCollision)
+}
+
+func TestMovementIgnoredUntilTeleportConfirmed(t *testing.T) {
+	player, recorder := newMovementPlayer(t)
+	player.Teleport(2.5, movementFloorY+1, 2.5)
+
+	// Sent by the client before it received the teleport
+	sendMovement(player, 8.5, movementFloorY+1, 8.7)
+	if x, _, _ := player.Pos(); x != 2.5 {
+		t.Fatalf("movement wasn't ignored: x=%f", x)
+	}
+
+	sendMovement(player, 2.5, movementFloorY+1, 2.5)
+	sendMovement(player, 2.5, movementFloorY+1, 2.7)
+
+	if _, _, z := player.Pos(); z != 2.7 {
+		t.Fatalf("movement after confirmation wasn't accepted: z=%f", z)
+	}
+
+	if len(recorder.violations) != 0 {
+		t.Fatalf("unexpected violations %v", recorder.violations)
+	}
+}
@@ -83,7 +83,7 @@ func unmarshalCompound(reader *bufio.Reader, v reflect.Value) error {
 
 		var field reflect.Value
 		if v.IsValid() {
-			field = v.FieldByName(key)
+			field = fieldByKey(v, key)
 			unmarshalledFields++
 		}
 
@@ -99,6 +99,27 @@ func unmarshalCompound(reader *bufio.Reader, v reflect.Value) error {
 	return nil
 }
 
+// Returns the struct field with the NBT key, or an invalid value if there is
+// none. See fieldKey.
+func fieldByKey(v reflect.Value, key string) reflect.Value {
+	for i := 0; i < v.NumField(); i++ {
+		if fieldKey(v.Type().Field(i)) == key {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// Returns the key a field is stored under. Defaults to the name of the field,
+// but can be overridden with a tag such as `nbt:"id"` for keys that aren't
+// exported names.
+func fieldKey(field reflect.StructField) string {
+	if key, ok := field.Tag.Lookup("nbt"); ok {
+		return key
+	}
+	return field.Name
+}
+
 func unmarshalList(reader *bufio.Reader, val reflect.Value) error {
 	elementType, err := reader.ReadByte()
 	if err != nil {
@@ -310,7 +331,7 @@ func marshalCompound(w io.Writer, v reflect.Value) error {
 
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
-		name := v.Type().Field(i).Name
+		name := fieldKey(v.Type().Field(i))
 
 		if err := writeTag(w, field.Type()); err != nil {
 			return err
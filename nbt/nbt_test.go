@@ -84,3 +84,35 @@ func TestMarshalUnmarshal(t *testing.T) {
 		t.Fatalf("struct %#v != %#v", val, decoded)
 	}
 }
+
+type TestTagged struct {
+	Name  string `nbt:"name"`
+	Value int32  `nbt:"value"`
+}
+
+func TestFieldKeyTag(t *testing.T) {
+	val := TestTagged{Name: "Eggbert", Value: 5}
+
+	var buf bytes.Buffer
+	if err := nbt.Marshal(val, "", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"\x00\x04name", "\x00\x05value"} {
+		if !bytes.Contains(buf.Bytes(), []byte(key)) {
+			t.Fatalf("field wasn't written under the key %q", key[2:])
+		}
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Name")) {
+		t.Fatal("field was written under its Go name")
+	}
+
+	var decoded TestTagged
+	if err := nbt.Unmarshal(bufio.NewReader(&buf), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != val {
+		t.Fatalf("struct %#v != %#v", val, decoded)
+	}
+}
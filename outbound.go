@@ -0,0 +1,268 @@
+package oneworld
+
+import (
+	"sync"
+	"time"
+)
+
+// What happens when a player's outbound queue is full, usually because their
+// connection can't keep up
+type OverflowPolicy int
+
+const (
+	// Kick the player as soon as the queue is full
+	OverflowKick OverflowPolicy = iota
+	// Stop sending chunks once the queue is half full and send them again
+	// after it empties. The player is still kicked if the queue fills up.
+	OverflowDropChunks
+)
+
+type OutboundLimits struct {
+	// Most bytes that can wait to be sent to the player
+	MaxQueuedBytes int
+	Overflow       OverflowPolicy
+	// How long writing to the connection can block before it's closed. Zero
+	// disables the timeout.
+	WriteTimeout time.Duration
+}
+
+// Enough for a player's whole view distance of chunks, which are about 10KB
+// each after compression
+var DefaultOutboundLimits = OutboundLimits{
+	MaxQueuedBytes: 8 << 20,
+	Overflow:       OverflowDropChunks,
+	WriteTimeout:   30 * time.Second,
+}
+
+const overflowMessage = "Your connection is too slow"
+
+// Size of the buffer packets are written to the connection through. Packets
+// are sent once per tick, or sooner if this much is waiting.
+const writeBufferSize = 32 * 1024
+
+type OutboundStats struct {
+	QueuedPackets int
+	QueuedBytes   int
+	// Highest value of QueuedBytes since the player joined
+	PeakQueuedBytes int
+	SentPackets     uint64
+	SentBytes       uint64
+	// Chunks that weren't sent because the queue was too full. They're sent
+	// again later.
+	DroppedChunks uint64
+}
+
+// Packets waiting to be written to a player's connection. Pushing never blocks
+// so that a slow client can't stall the tick loop.
+type outboundQueue struct {
+	mu      sync.Mutex
+	packets [][]byte
+	limits  OutboundLimits
+	stats   OutboundStats
+	closed  bool
+	// Bytes in packets that haven't been taken by the writer
+	waitingBytes int
+	// Has a value when packets should be written or the queue was closed
+	ready chan struct{}
+}
+
+func newOutboundQueue(limits OutboundLimits) *outboundQueue {
+	return &outboundQueue{
+		packets: make([][]byte, 0),
+		limits:  limits,
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// Adds the packet unless it would take the queue past the limit. Pushing to a
+// closed queue does nothing.
+func (queue *outboundQueue) push(packet []byte) bool {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if queue.stats.QueuedBytes+len(packet) > queue.limits.MaxQueuedBytes {
+		return false
+	}
+	queue.pushLocked(packet)
+	return true
+}
+
+// Adds a chunk if the queue is empty enough under the overflow policy.
+// Returns whether it was queued, and if not, whether it should be sent again
+// later instead of kicking the player.
+func (queue *outboundQueue) pushChunk(packet []byte) (bool, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if queue.limits.Overflow == OverflowDropChunks {
+		if queue.stats.QueuedBytes+len(packet) > queue.limits.MaxQueuedBytes/2 {
+			queue.stats.DroppedChunks++
+			return false, true
+		}
+	} else if queue.stats.QueuedBytes+len(packet) > queue.limits.MaxQueuedBytes {
+		return false, false
+	}
+
+	queue.pushLocked(packet)
+	return true, false
+}
+
+// Adds the packet regardless of the limit
+func (queue *outboundQueue) forcePush(packet []byte) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	queue.pushLocked(packet)
+}
+
+func (queue *outboundQueue) pushLocked(packet []byte) {
+	if queue.closed {
+		return
+	}
+
+	queue.packets = append(queue.packets, packet)
+	queue.waitingBytes += len(packet)
+	queue.stats.QueuedPackets++
+	queue.stats.QueuedBytes += len(packet)
+	if queue.stats.QueuedBytes > queue.stats.PeakQueuedBytes {
+		queue.stats.PeakQueuedBytes = queue.stats.QueuedBytes
+	}
+
+	// Start writing before the end of the tick if there's enough to fill the
+	// buffer
+	if queue.waitingBytes >= writeBufferSize {
+		queue.signal()
+	}
+}
+
+// Lets the writer send everything pushed so far
+func (queue *outboundQueue) flush() {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if queue.waitingBytes > 0 {
+		queue.signal()
+	}
+}
+
+func (queue *outboundQueue) signal() {
+	select {
+	case queue.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Prevents more packets from being pushed. Packets already in the queue can
+// still be taken.
+func (queue *outboundQueue) close() {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	queue.closed = true
+	queue.signal()
+}
+
+// Waits for packets and removes all of them from the queue. Returns false once
+// the queue is closed and empty.
+func (queue *outboundQueue) take() ([][]byte, bool) {
+	for {
+		queue.mu.Lock()
+		if len(queue.packets) > 0 {
+			packets := queue.packets
+			queue.packets = make([][]byte, 0, len(packets))
+			queue.waitingBytes = 0
+			queue.mu.Unlock()
+			return packets, true
+		}
+
+		closed := queue.closed
+		queue.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+		<-queue.ready
+	}
+}
+
+// Records that the packets were written and removes them from the queued
+// totals
+func (queue *outboundQueue) sent(packets [][]byte) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	for _, packet := range packets {
+		queue.stats.QueuedPackets--
+		queue.stats.QueuedBytes -= len(packet)
+		queue.stats.SentPackets++
+		queue.stats.SentBytes += uint64(len(packet))
+	}
+}
+
+// Removes packets from the queued totals without writing them
+func (queue *outboundQueue) discard(packets [][]byte) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	for _, packet := range packets {
+		queue.stats.QueuedPackets--
+		queue.stats.QueuedBytes -= len(packet)
+	}
+}
+
+func (queue *outboundQueue) setLimits(limits OutboundLimits) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	queue.limits = limits
+}
+
+func (queue *outboundQueue) writeTimeout() time.Duration {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return queue.limits.WriteTimeout
+}
+
+func (queue *outboundQueue) getStats() OutboundStats {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return queue.stats
+}
+
+// Whether the queue has emptied enough for dropped chunks to be sent again
+func (queue *outboundQueue) canResendChunks() bool {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return queue.stats.QueuedBytes <= queue.limits.MaxQueuedBytes/4
+}
+
+// Sets the limits on how much can be queued to be sent to the player and what
+// happens when they're exceeded
+func (player *PlayerBase[S]) SetOutboundLimits(limits OutboundLimits) {
+	player.outbound.setLimits(limits)
+}
+
+// Returns statistics about the packets sent to the player. Safe to call from
+// any goroutine.
+func (player *PlayerBase[S]) OutboundStats() OutboundStats {
+	return player.outbound.getStats()
+}
+
+// Called when a packet couldn't be queued. Pending block changes are dropped
+// because there's no room to send them before the kick.
+func (player *PlayerBase[S]) overflow() {
+	for pos := range player.pendingBlockChanges {
+		delete(player.pendingBlockChanges, pos)
+	}
+	player.Kick(overflowMessage)
+}
+
+// Sends chunks that were dropped while the queue was full if it has emptied
+func (player *PlayerBase[S]) resendDroppedChunks() {
+	if len(player.droppedChunks) == 0 || !player.outbound.canResendChunks() {
+		return
+	}
+
+	for pos := range player.droppedChunks {
+		delete(player.droppedChunks, pos)
+		if chunk := player.Server.Chunk(pos.X, pos.Z); chunk != nil {
+			player.sendChunk(pos.X, pos.Z, chunk)
+		}
+	}
+}
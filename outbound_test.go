@@ -0,0 +1,157 @@
+package oneworld
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+func TestOverflowKick(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	player.SetOutboundLimits(OutboundLimits{MaxQueuedBytes: 100, Overflow: OverflowKick})
+
+	for i := 0; i < 10; i++ {
+		player.Message("0123456789")
+	}
+
+	if !player.disconnected {
+		t.Fatal("player wasn't kicked")
+	}
+
+	packets := queuedPackets(player)
+	if last := packets[len(packets)-1]; last[0] != protocol.DisconnectId {
+		t.Fatalf("last packet was %d", last[0])
+	}
+}
+
+func TestOverflowKickWithBlockChanges(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	player.SetOutboundLimits(OutboundLimits{MaxQueuedBytes: 100, Overflow: OverflowKick})
+
+	for x := 0; x < 5; x++ {
+		player.SendBlockChange(x*16, 10, 0, blocks.Block{Type: blocks.Stone})
+	}
+	for i := 0; i < 10; i++ {
+		player.Message("0123456789")
+	}
+
+	kicks := 0
+	for _, packet := range queuedPackets(player) {
+		switch packet[0] {
+		case protocol.DisconnectId:
+			kicks++
+		case protocol.BlockChangeId:
+			t.Error("block change was queued after overflowing")
+		}
+	}
+	if kicks != 1 {
+		t.Fatalf("sent %d kicks", kicks)
+	}
+}
+
+func TestKickOverflowsWhileFlushing(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	player.SetOutboundLimits(OutboundLimits{MaxQueuedBytes: 30, Overflow: OverflowKick})
+
+	// Only the first of these fits
+	for x := 0; x < 5; x++ {
+		player.SendBlockChange(x*16, 10, 0, blocks.Block{Type: blocks.Stone})
+	}
+	player.Kick("Kicked by an operator")
+
+	var kicks [][]byte
+	for _, packet := range queuedPackets(player) {
+		if packet[0] == protocol.DisconnectId {
+			kicks = append(kicks, packet)
+		}
+	}
+	if len(kicks) != 1 || !bytes.Equal(kicks[0], protocol.NewKick(overflowMessage).Marshal()) {
+		t.Fatalf("sent kicks %v", kicks)
+	}
+}
+
+func TestOverflowDropChunks(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	chunk := player.Server.Chunk(0, 0)
+	chunkSize := len((&protocol.ChunkDataPacket{Data: chunk.serializeToNetwork()}).Marshal())
+	player.SetOutboundLimits(OutboundLimits{MaxQueuedBytes: chunkSize * 3, Overflow: OverflowDropChunks})
+
+	player.sendChunk(0, 0, chunk)
+	player.sendChunk(0, 0, chunk)
+	if player.disconnected {
+		t.Fatal("player was kicked")
+	}
+	if len(player.droppedChunks) != 1 || player.OutboundStats().DroppedChunks != 1 {
+		t.Fatalf("dropped %d chunks", player.OutboundStats().DroppedChunks)
+	}
+
+	// Still too full
+	player.resendDroppedChunks()
+	if len(player.droppedChunks) != 1 {
+		t.Fatal("chunk was resent before the queue emptied")
+	}
+
+	queuedPackets(player)
+	player.resendDroppedChunks()
+	if len(player.droppedChunks) != 0 || player.OutboundStats().QueuedPackets != 1 {
+		t.Fatal("chunk wasn't resent")
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	player.conn = serverConn
+	player.writeLoopDone = make(chan struct{})
+	player.SetOutboundLimits(OutboundLimits{MaxQueuedBytes: 1 << 20, WriteTimeout: 50 * time.Millisecond})
+	go player.writeLoop()
+
+	// Nothing reads from the client's end
+	player.Message("hello")
+	player.flushPackets()
+
+	select {
+	case <-player.writeLoopDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write didn't time out")
+	}
+
+	if _, err := clientConn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("connection wasn't closed: %v", err)
+	}
+
+	if stats := player.OutboundStats(); stats.QueuedBytes != 0 || stats.SentPackets != 0 {
+		t.Fatalf("got stats %+v", stats)
+	}
+}
+
+func TestOutboundStats(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	player.conn = serverConn
+	player.writeLoopDone = make(chan struct{})
+	go player.writeLoop()
+
+	message := (&protocol.ChatPacket{Message: "hello"}).Marshal()
+	kick := protocol.NewKick("bye").Marshal()
+	player.Message("hello")
+	player.Message("hello")
+	player.Kick("bye")
+
+	if _, err := io.ReadAll(clientConn); err != nil {
+		t.Fatal(err)
+	}
+	<-player.writeLoopDone
+
+	stats := player.OutboundStats()
+	if stats.SentPackets != 3 || stats.SentBytes != uint64(2*len(message)+len(kick)) || stats.PeakQueuedBytes < len(message) {
+		t.Fatalf("got stats %+v", stats)
+	}
+}
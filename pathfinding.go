@@ -0,0 +1,339 @@
+package oneworld
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/util"
+)
+
+// The furthest an entity is allowed to fall in a single move
+const maxPathDrop = 3
+
+// How close (squared, horizontally) an entity must get to the center of a path
+// node before it moves on to the next one
+const pathNodeReachedDistSq = 0.35 * 0.35
+
+type BlockPos struct {
+	X int
+	Y int
+	Z int
+}
+
+type BlockAccess interface {
+	GetBlock(x, y, z int) blocks.Block
+}
+
+// A sequence of positions an entity's feet should pass through. Paths are
+// never modified after being created, so they can be shared between any
+// number of entities. See PathFollower.
+type Path []BlockPos
+
+// Tracks the progress of a single entity along a Path
+type PathFollower struct {
+	path  Path
+	index int
+}
+
+func NewPathFollower(path Path) *PathFollower {
+	return &PathFollower{
+		path:  path,
+		index: 0,
+	}
+}
+
+// Returns the node the entity should be moving towards, skipping any nodes it
+// has already reached. Returns false when the end of the path has been
+// reached.
+func (follower *PathFollower) Next(entity Entity) (BlockPos, bool) {
+	x, y, z := entity.Pos()
+
+	for follower.index < len(follower.path) {
+		node := follower.path[follower.index]
+		dx := x - (float64(node.X) + 0.5)
+		dz := z - (float64(node.Z) + 0.5)
+
+		if dx*dx+dz*dz > pathNodeReachedDistSq || math.Abs(y-float64(node.Y)) >= 1 {
+			return node, true
+		}
+		follower.index++
+	}
+
+	return BlockPos{}, false
+}
+
+// Performs an A* search over the block grid. The search is incremental so that
+// it can be spread across multiple ticks with Step().
+type Pathfinder struct {
+	world    BlockAccess
+	goal     BlockPos
+	maxNodes int
+	expanded int
+
+	open  pathHeap
+	nodes map[BlockPos]*pathNode
+	moves []pathMove
+
+	done bool
+	path Path
+}
+
+type pathNode struct {
+	pos    BlockPos
+	parent *pathNode
+	// Cost from the start node
+	g float64
+	// g plus the estimated cost to the goal
+	f float64
+	// Position in the open heap
+	index  int
+	closed bool
+}
+
+type pathMove struct {
+	pos  BlockPos
+	cost float64
+}
+
+// Creates a pathfinder that will give up after expanding maxNodes nodes in
+// total.
+func NewPathfinder(world BlockAccess, start, goal BlockPos, maxNodes int) *Pathfinder {
+	pf := &Pathfinder{
+		world:    world,
+		goal:     goal,
+		maxNodes: maxNodes,
+		expanded: 0,
+
+		open:  make(pathHeap, 0),
+		nodes: make(map[BlockPos]*pathNode),
+		moves: make([]pathMove, 0, 8),
+	}
+
+	startNode := &pathNode{
+		pos: start,
+		g:   0,
+		f:   pf.heuristic(start),
+	}
+	pf.nodes[start] = startNode
+	heap.Push(&pf.open, startNode)
+
+	return pf
+}
+
+// Runs a complete search in one call. Returns nil if no path was found.
+func FindPath(world BlockAccess, start, goal BlockPos, maxNodes int) Path {
+	pf := NewPathfinder(world, start, goal, maxNodes)
+	for !pf.Step(maxNodes) {
+	}
+	return pf.Path()
+}
+
+// Expands at most budget nodes. Returns true once the search has finished,
+// either because a path was found or because one doesn't exist within the
+// node limit.
+func (pf *Pathfinder) Step(budget int) bool {
+	for i := 0; i < budget && !pf.done; i++ {
+		if pf.open.Len() == 0 || pf.expanded >= pf.maxNodes {
+			pf.done = true
+			break
+		}
+
+		node := heap.Pop(&pf.open).(*pathNode)
+		node.closed = true
+		pf.expanded++
+
+		if node.pos == pf.goal {
+			pf.path = reconstructPath(node)
+			pf.done = true
+			break
+		}
+
+		pf.moves = pf.appendMoves(pf.moves[:0], node.pos)
+		for _, move := range pf.moves {
+			g := node.g + move.cost
+
+			neighbor, ok := pf.nodes[move.pos]
+			if !ok {
+				neighbor = &pathNode{
+					pos:    move.pos,
+					parent: node,
+					g:      g,
+					f:      g + pf.heuristic(move.pos),
+				}
+				pf.nodes[move.pos] = neighbor
+				heap.Push(&pf.open, neighbor)
+				continue
+			}
+
+			if neighbor.closed || g >= neighbor.g {
+				continue
+			}
+
+			neighbor.parent = node
+			neighbor.g = g
+			neighbor.f = g + pf.heuristic(move.pos)
+			heap.Fix(&pf.open, neighbor.index)
+		}
+	}
+
+	return pf.done
+}
+
+func (pf *Pathfinder) Done() bool {
+	return pf.done
+}
+
+// Returns the path that was found, or nil if the search is still running or
+// failed.
+func (pf *Pathfinder) Path() Path {
+	return pf.path
+}
+
+func reconstructPath(node *pathNode) Path {
+	length := 0
+	for n := node; n != nil; n = n.parent {
+		length++
+	}
+
+	path := make(Path, length)
+	for n := node; n != nil; n = n.parent {
+		length--
+		path[length] = n.pos
+	}
+	return path
+}
+
+// Every move advances at least one block horizontally for a cost of at least
+// 1, or up to maxPathDrop blocks vertically, so this never overestimates.
+func (pf *Pathfinder) heuristic(pos BlockPos) float64 {
+	horizontal := util.IAbs(pos.X-pf.goal.X) + util.IAbs(pos.Z-pf.goal.Z)
+	vertical := float64(util.IAbs(pos.Y-pf.goal.Y)) / maxPathDrop
+	return math.Max(float64(horizontal), vertical)
+}
+
+var pathDirections = [...]BlockPos{
+	{X: 1, Y: 0, Z: 0},
+	{X: -1, Y: 0, Z: 0},
+	{X: 0, Y: 0, Z: 1},
+	{X: 0, Y: 0, Z: -1},
+}
+
+func (pf *Pathfinder) appendMoves(moves []pathMove, pos BlockPos) []pathMove {
+	for _, dir := range pathDirections {
+		next := BlockPos{pos.X + dir.X, pos.Y, pos.Z + dir.Z}
+
+		if pf.canStand(next) {
+			cost := 1.
+			if pf.inWater(next) {
+				cost = 2
+			}
+			moves = append(moves, pathMove{next, cost})
+			continue
+		}
+
+		if pf.canOccupy(next) {
+			for drop := 1; drop <= maxPathDrop; drop++ {
+				below := BlockPos{next.X, next.Y - drop, next.Z}
+				if !pf.canOccupy(below) {
+					break
+				}
+
+				if pf.canStand(below) {
+					moves = append(moves, pathMove{below, 1 + 0.5*float64(drop)})
+					break
+				}
+			}
+			continue
+		}
+
+		up := BlockPos{next.X, next.Y + 1, next.Z}
+		if pf.canStand(up) && pf.passable(pos.X, pos.Y+2, pos.Z) {
+			moves = append(moves, pathMove{up, 2})
+		}
+	}
+
+	if pf.inWater(pos) {
+		up := BlockPos{pos.X, pos.Y + 1, pos.Z}
+		if pf.canStand(up) {
+			moves = append(moves, pathMove{up, 2})
+		}
+
+		down := BlockPos{pos.X, pos.Y - 1, pos.Z}
+		if pf.canStand(down) {
+			moves = append(moves, pathMove{down, 2})
+		}
+	}
+
+	return moves
+}
+
+// Whether an entity two blocks tall can be at the position and not fall
+func (pf *Pathfinder) canStand(pos BlockPos) bool {
+	if !pf.canOccupy(pos) {
+		return false
+	}
+
+	if pf.inWater(pos) {
+		return true
+	}
+
+	below := pf.world.GetBlock(pos.X, pos.Y-1, pos.Z)
+	// Fences are 1.5 blocks tall, so nothing can stand on or jump over them
+	return below.Solid() && below.Type != blocks.Fence
+}
+
+// Whether an entity two blocks tall fits at the position
+func (pf *Pathfinder) canOccupy(pos BlockPos) bool {
+	return pf.passable(pos.X, pos.Y, pos.Z) && pf.passable(pos.X, pos.Y+1, pos.Z)
+}
+
+// Whether an entity can move through the block. Wooden doors are passable even
+// though Solid reports them as solid, because mobs can open them. Lava and fire
+// are never passable so that paths stay clear of them.
+func (pf *Pathfinder) passable(x, y, z int) bool {
+	block := pf.world.GetBlock(x, y, z)
+	switch block.Type {
+	case blocks.FlowingLava, blocks.Lava, blocks.Fire:
+		return false
+	case blocks.WoodenDoor:
+		return true
+	default:
+		return !block.Solid()
+	}
+}
+
+func (pf *Pathfinder) inWater(pos BlockPos) bool {
+	ty := pf.world.GetBlock(pos.X, pos.Y, pos.Z).Type
+	return ty == blocks.Water || ty == blocks.FlowingWater
+}
+
+type pathHeap []*pathNode
+
+func (h pathHeap) Len() int {
+	return len(h)
+}
+
+func (h pathHeap) Less(i, j int) bool {
+	return h[i].f < h[j].f
+}
+
+func (h pathHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *pathHeap) Push(x any) {
+	node := x.(*pathNode)
+	node.index = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *pathHeap) Pop() any {
+	old := *h
+	node := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return node
+}
@@ -0,0 +1,252 @@
+package oneworld
+
+import (
+	"context"
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+)
+
+const pathFloorY = 9
+
+// Creates a single-chunk world with a stone floor. Entities standing on the
+// floor have their feet at pathFloorY+1.
+func newPathWorld(t *testing.T, build func(chunk *Chunk)) *Server {
+	chunk := new(Chunk)
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			chunk.Set(x, pathFloorY, z, blocks.Block{Type: blocks.Stone})
+		}
+	}
+
+	if build != nil {
+		build(chunk)
+	}
+
+	server, err := NewServer(1, []*Chunk{chunk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+	return server
+}
+
+func wallAlongZ(chunk *Chunk, x, height int, block blocks.Block) {
+	for z := 0; z < 16; z++ {
+		for y := pathFloorY + 1; y <= pathFloorY+height; y++ {
+			chunk.Set(x, y, z, block)
+		}
+	}
+}
+
+func pos(x, y, z int) BlockPos {
+	return BlockPos{X: x, Y: y, Z: z}
+}
+
+func checkContinuous(t *testing.T, path Path, start, goal BlockPos) {
+	if path == nil {
+		t.Fatal("no path found")
+	}
+
+	if path[0] != start || path[len(path)-1] != goal {
+		t.Fatalf("path %v doesn't go from %v to %v", path, start, goal)
+	}
+
+	for i := 1; i < len(path); i++ {
+		dx := path[i].X - path[i-1].X
+		dz := path[i].Z - path[i-1].Z
+		if dx*dx+dz*dz > 1 {
+			t.Fatalf("path jumps from %v to %v", path[i-1], path[i])
+		}
+	}
+}
+
+func TestPathFlat(t *testing.T) {
+	world := newPathWorld(t, nil)
+	start := pos(1, pathFloorY+1, 1)
+	goal := pos(10, pathFloorY+1, 1)
+
+	path := FindPath(world, start, goal, 1000)
+	checkContinuous(t, path, start, goal)
+	if len(path) != 10 {
+		t.Fatalf("expected straight path of 10 nodes but got %v", path)
+	}
+}
+
+func TestPathAroundWall(t *testing.T) {
+	world := newPathWorld(t, func(chunk *Chunk) {
+		wallAlongZ(chunk, 5, 2, blocks.Block{Type: blocks.Stone})
+		chunk.Set(5, pathFloorY+1, 14, blocks.Block{})
+		chunk.Set(5, pathFloorY+2, 14, blocks.Block{})
+	})
+	start := pos(1, pathFloorY+1, 1)
+	goal := pos(10, pathFloorY+1, 1)
+
+	path := FindPath(world, start, goal, 5000)
+	checkContinuous(t, path, start, goal)
+
+	for _, node := range path {
+		if node.X == 5 && node.Z != 14 {
+			t.Fatalf("path %v passes through the wall", path)
+		}
+	}
+}
+
+func TestPathStepUp(t *testing.T) {
+	world := newPathWorld(t, func(chunk *Chunk) {
+		wallAlongZ(chunk, 5, 1, blocks.Block{Type: blocks.Stone})
+	})
+	start := pos(1, pathFloorY+1, 1)
+	goal := pos(10, pathFloorY+1, 1)
+
+	path := FindPath(world, start, goal, 1000)
+	checkContinuous(t, path, start, goal)
+
+	for _, node := range path {
+		if node.X == 5 && node.Y != pathFloorY+2 {
+			t.Fatalf("path %v doesn't step on top of the wall", path)
+		}
+	}
+}
+
+func TestPathBlocked(t *testing.T) {
+	world := newPathWorld(t, func(chunk *Chunk) {
+		wallAlongZ(chunk, 5, 2, blocks.Block{Type: blocks.Stone})
+	})
+
+	path := FindPath(world, pos(1, pathFloorY+1, 1), pos(10, pathFloorY+1, 1), 5000)
+	if path != nil {
+		t.Fatalf("expected no path but got %v", path)
+	}
+}
+
+func TestPathFence(t *testing.T) {
+	world := newPathWorld(t, func(chunk *Chunk) {
+		wallAlongZ(chunk, 5, 1, blocks.Block{Type: blocks.Fence})
+	})
+
+	path := FindPath(world, pos(1, pathFloorY+1, 1), pos(10, pathFloorY+1, 1), 5000)
+	if path != nil {
+		t.Fatalf("expected fence to be impassable but got %v", path)
+	}
+}
+
+func TestPathDrop(t *testing.T) {
+	for height, expectPath := range map[int]bool{1: true, 3: true, 4: false} {
+		world := newPathWorld(t, func(chunk *Chunk) {
+			for y := pathFloorY + 1; y < pathFloorY+1+height; y++ {
+				chunk.Set(1, y, 1, blocks.Block{Type: blocks.Stone})
+			}
+		})
+		start := pos(1, pathFloorY+1+height, 1)
+		goal := pos(5, pathFloorY+1, 1)
+
+		path := FindPath(world, start, goal, 1000)
+		if expectPath {
+			checkContinuous(t, path, start, goal)
+		} else if path != nil {
+			t.Fatalf("expected no path from height %d but got %v", height, path)
+		}
+	}
+}
+
+func TestPathAvoidsLava(t *testing.T) {
+	world := newPathWorld(t, func(chunk *Chunk) {
+		for z := 0; z < 15; z++ {
+			chunk.Set(5, pathFloorY, z, blocks.Block{Type: blocks.Lava})
+		}
+	})
+	start := pos(1, pathFloorY+1, 1)
+	goal := pos(10, pathFloorY+1, 1)
+
+	path := FindPath(world, start, goal, 5000)
+	checkContinuous(t, path, start, goal)
+
+	for _, node := range path {
+		if node.X == 5 && node.Z != 15 {
+			t.Fatalf("path %v crosses lava", path)
+		}
+	}
+}
+
+func TestPathDoors(t *testing.T) {
+	for door, expectPath := range map[blocks.BlockType]bool{blocks.WoodenDoor: true, blocks.IronDoor: false} {
+		world := newPathWorld(t, func(chunk *Chunk) {
+			wallAlongZ(chunk, 5, 2, blocks.Block{Type: blocks.Stone})
+			chunk.Set(5, pathFloorY+1, 8, blocks.Block{Type: door})
+			chunk.Set(5, pathFloorY+2, 8, blocks.Block{Type: door, Data: blocks.DoorTop})
+		})
+		start := pos(1, pathFloorY+1, 1)
+		goal := pos(10, pathFloorY+1, 1)
+
+		path := FindPath(world, start, goal, 5000)
+		if expectPath {
+			checkContinuous(t, path, start, goal)
+		} else if path != nil {
+			t.Fatalf("expected door %d to be impassable but got %v", door, path)
+		}
+	}
+}
+
+func TestPathSwim(t *testing.T) {
+	world := newPathWorld(t, func(chunk *Chunk) {
+		// A pool of water that's deeper than the entity can drop
+		for x := 3; x <= 7; x++ {
+			for z := 0; z < 16; z++ {
+				for y := pathFloorY - 5; y <= pathFloorY; y++ {
+					chunk.Set(x, y, z, blocks.Block{Type: blocks.Water})
+				}
+			}
+		}
+	})
+	start := pos(1, pathFloorY+1, 1)
+	goal := pos(10, pathFloorY+1, 1)
+
+	path := FindPath(world, start, goal, 5000)
+	checkContinuous(t, path, start, goal)
+}
+
+func TestPathBudget(t *testing.T) {
+	world := newPathWorld(t, func(chunk *Chunk) {
+		wallAlongZ(chunk, 5, 2, blocks.Block{Type: blocks.Stone})
+		chunk.Set(5, pathFloorY+1, 14, blocks.Block{})
+		chunk.Set(5, pathFloorY+2, 14, blocks.Block{})
+	})
+	start := pos(1, pathFloorY+1, 1)
+	goal := pos(10, pathFloorY+1, 1)
+
+	pf := NewPathfinder(world, start, goal, 5000)
+	steps := 0
+	for !pf.Step(4) {
+		steps++
+		if pf.Path() != nil {
+			t.Fatal("path available before search finished")
+		}
+	}
+
+	if steps == 0 {
+		t.Fatal("expected search to span multiple steps")
+	}
+	checkContinuous(t, pf.Path(), start, goal)
+}
+
+func TestPathFollower(t *testing.T) {
+	world := newPathWorld(t, nil)
+	path := FindPath(world, pos(1, pathFloorY+1, 1), pos(3, pathFloorY+1, 1), 1000)
+
+	entity := world.AllocateEntity(1.5, pathFloorY+1, 1.5)
+	follower := NewPathFollower(path)
+	if next, ok := follower.Next(&entity); !ok || next != pos(2, pathFloorY+1, 1) {
+		t.Fatalf("expected next node to be (2, %d, 1) but got %v", pathFloorY+1, next)
+	}
+
+	entity = world.AllocateEntity(2.5, pathFloorY+1, 1.5)
+	if next, ok := follower.Next(&entity); !ok || next != pos(3, pathFloorY+1, 1) {
+		t.Fatalf("expected next node to be (3, %d, 1) but got %v", pathFloorY+1, next)
+	}
+
+	entity = world.AllocateEntity(3.5, pathFloorY+1, 1.5)
+	if next, ok := follower.Next(&entity); ok {
+		t.Fatalf("expected path to be finished but got %v", next)
+	}
+}
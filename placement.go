@@ -0,0 +1,469 @@
+package oneworld
+
+import (
+	"math"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/geom"
+	"github.com/richgrov/oneworld/items"
+)
+
+// Blocks placed by items that aren't blocks themselves
+var itemBlocks = map[items.ItemId]blocks.BlockType{
+	items.Door:      blocks.WoodenDoor,
+	items.IronDoor:  blocks.IronDoor,
+	items.Redstone:  blocks.Redstone,
+	items.Sugarcane: blocks.SugarCane,
+	items.Cake:      blocks.Cake,
+	items.Repeater:  blocks.RepeaterOff,
+	items.Bed:       blocks.Bed,
+	items.Sign:      blocks.StandingSign,
+	items.Seeds:     blocks.Wheat,
+}
+
+// Blocks whose data value is the damage of the item that placed them, such as
+// the color of wool
+var dataFromDamage = map[blocks.BlockType]bool{
+	blocks.Sapling: true,
+	blocks.Log:     true,
+	blocks.Leaves:  true,
+	blocks.Wool:    true,
+	blocks.Slab:    true,
+}
+
+// Blocks that are used when clicked instead of having blocks placed against
+// them
+var interactiveBlocks = map[blocks.BlockType]bool{
+	blocks.Chest:         true,
+	blocks.Furnace:       true,
+	blocks.LitFurnace:    true,
+	blocks.Dispenser:     true,
+	blocks.CraftingTable: true,
+	blocks.WoodenDoor:    true,
+	blocks.Trapdoor:      true,
+	blocks.Lever:         true,
+	blocks.Button:        true,
+	blocks.Bed:           true,
+	blocks.NoteBlock:     true,
+	blocks.Jukebox:       true,
+	blocks.RepeaterOff:   true,
+	blocks.RepeaterOn:    true,
+	blocks.Cake:          true,
+}
+
+type placement struct {
+	pos   BlockPos
+	block blocks.Block
+}
+
+// Places the held item as a block against the clicked block, as the client
+// does when right-clicking. The arguments are the same as those passed to
+// PlayerEventHandler.OnInteractBlock. Blocks are oriented based on the clicked
+// face and the direction the player is facing, and the held stack is
+// decremented. If the item can't be placed, the client's copy of the world and
+// inventory is corrected and false is returned.
+func (player *PlayerBase[S]) PlaceHeldItem(clickedX, clickedY, clickedZ, newX, newY, newZ int) bool {
+	clicked := BlockPos{clickedX, clickedY, clickedZ}
+	target := BlockPos{newX, newY, newZ}
+
+	face, ok := faceBetween(clicked, target)
+	if !ok {
+		return false
+	}
+
+	clickedBlock := player.getBlock(clicked)
+	if interactiveBlocks[clickedBlock.Type] {
+		return false
+	}
+
+	slot := hotbarSlotStart + player.hotbarSlot
+	held := player.items[slot]
+	if held.IsEmpty() {
+		return false
+	}
+
+	// Snow is replaced instead of being built on
+	if clickedBlock.Type == blocks.SnowLayer {
+		target = clicked
+		face = geom.FaceTop
+	}
+
+	placements := player.placementsFor(&held, clicked, target, face)
+	if placements == nil || !player.canPlace(placements) {
+		player.SendBlockChange(target.X, target.Y, target.Z, player.getBlock(target))
+		for _, placement := range placements {
+			pos := placement.pos
+			player.SendBlockChange(pos.X, pos.Y, pos.Z, player.getBlock(pos))
+		}
+		player.syncSlot(slot)
+		return false
+	}
+
+	for _, placement := range placements {
+		pos := placement.pos
+		player.Server.SetBlock(pos.X, pos.Y, pos.Z, placement.block)
+	}
+	player.consumeItem(slot)
+	return true
+}
+
+// Returns the face of the clicked block that the target is placed against
+func faceBetween(clicked, target BlockPos) (geom.Face, bool) {
+	switch (BlockPos{target.X - clicked.X, target.Y - clicked.Y, target.Z - clicked.Z}) {
+	case BlockPos{0, -1, 0}:
+		return geom.FaceBottom, true
+	case BlockPos{0, 1, 0}:
+		return geom.FaceTop, true
+	case BlockPos{0, 0, -1}:
+		return geom.FaceNegativeZ, true
+	case BlockPos{0, 0, 1}:
+		return geom.FacePositiveZ, true
+	case BlockPos{-1, 0, 0}:
+		return geom.FaceNegativeX, true
+	case BlockPos{1, 0, 0}:
+		return geom.FacePositiveX, true
+	default:
+		return 0, false
+	}
+}
+
+// Returns the direction the player is facing, from 0 to 3: positive Z,
+// negative X, negative Z, positive X
+func yawQuadrant(yaw float32) int {
+	return int(math.Floor(float64(yaw)*4/360+0.5)) & 3
+}
+
+// Offsets of the block in front of the player for each yaw quadrant
+var quadrantOffsets = [4]BlockPos{{0, 0, 1}, {-1, 0, 0}, {0, 0, -1}, {1, 0, 0}}
+
+// Returns the data value of a block mounted on the side of the clicked block,
+// facing away from it, or false if the face isn't a side
+func wallMountData(face geom.Face, north, south, west, east blocks.BlockData) (blocks.BlockData, bool) {
+	switch face {
+	case geom.FaceNegativeZ:
+		return north, true
+	case geom.FacePositiveZ:
+		return south, true
+	case geom.FaceNegativeX:
+		return west, true
+	case geom.FacePositiveX:
+		return east, true
+	default:
+		return 0, false
+	}
+}
+
+// Returns the blocks to place, or nil if the item can't be placed there
+func (player *PlayerBase[S]) placementsFor(item *ItemStack, clicked, target BlockPos, face geom.Face) []placement {
+	var blockType blocks.BlockType
+	if itemBlock, ok := itemBlocks[items.ItemId(item.Id)]; ok {
+		blockType = itemBlock
+	} else if item.Id > 0 && item.Id <= uint16(blocks.Trapdoor) {
+		blockType = blocks.BlockType(item.Id)
+	} else {
+		return nil
+	}
+
+	block := blocks.Block{Type: blockType}
+	if dataFromDamage[blockType] {
+		block.Data = blocks.BlockData(item.Damage)
+	}
+
+	below := player.getBlock(BlockPos{target.X, target.Y - 1, target.Z})
+	quadrant := yawQuadrant(player.yaw)
+
+	if !canStayOn(blockType, below, player.Server, target) {
+		return nil
+	}
+
+	switch blockType {
+	case blocks.WoodStairs, blocks.StoneStairs:
+		block.Data = [4]blocks.BlockData{blocks.StairsSouth, blocks.StairsWest, blocks.StairsNorth, blocks.StairsEast}[quadrant]
+
+	case blocks.Furnace, blocks.LitFurnace:
+		block.Data = [4]blocks.BlockData{blocks.FurnaceNorth, blocks.FurnaceEast, blocks.FurnaceSouth, blocks.FurnaceWest}[quadrant]
+
+	case blocks.Dispenser:
+		block.Data = [4]blocks.BlockData{blocks.DispenserNorth, blocks.DispenserEast, blocks.DispenserSouth, blocks.DispenserWest}[quadrant]
+
+	case blocks.Pumpkin, blocks.JackOLantern, blocks.RepeaterOff:
+		block.Data = blocks.BlockData((quadrant + 2) & 3)
+
+	case blocks.Piston, blocks.StickyPiston:
+		block.Data = player.pistonFacing(target, quadrant)
+
+	case blocks.Torch, blocks.RedstoneTorchOff, blocks.RedstoneTorchOn:
+		if !player.getBlock(clicked).Solid() {
+			return nil
+		}
+		if face == geom.FaceTop {
+			block.Data = blocks.TorchFloor
+		} else if data, ok := wallMountData(face, blocks.TorchNorth, blocks.TorchSouth, blocks.TorchWest, blocks.TorchEast); ok {
+			block.Data = data
+		} else {
+			return nil
+		}
+
+	case blocks.Ladder:
+		data, ok := wallMountData(face, blocks.LadderNorth, blocks.LadderSouth, blocks.LadderWest, blocks.LadderEast)
+		if !ok || !player.getBlock(clicked).Solid() {
+			return nil
+		}
+		block.Data = data
+
+	case blocks.Lever:
+		if !player.getBlock(clicked).Solid() {
+			return nil
+		}
+		if face == geom.FaceTop {
+			block.Data = blocks.LeverFloorNS
+			if quadrant%2 == 1 {
+				block.Data = blocks.LeverFloorWE
+			}
+		} else if data, ok := wallMountData(face, blocks.LeverNorth, blocks.LeverSouth, blocks.LeverWest, blocks.LeverEast); ok {
+			block.Data = data
+		} else {
+			return nil
+		}
+
+	case blocks.Button:
+		data, ok := wallMountData(face, blocks.ButtonNorth, blocks.ButtonSouth, blocks.ButtonWest, blocks.ButtonEast)
+		if !ok || !player.getBlock(clicked).Solid() {
+			return nil
+		}
+		block.Data = data
+
+	case blocks.StandingSign:
+		if face == geom.FaceTop {
+			block.Data = blocks.BlockData(int(math.Floor(float64(player.yaw+180)*16/360+0.5)) & 15)
+			break
+		}
+
+		data, ok := wallMountData(face, blocks.WallSignNorth, blocks.WallSignSouth, blocks.WallSignWest, blocks.WallSignEast)
+		if !ok {
+			return nil
+		}
+		block = blocks.Block{Type: blocks.WallSign, Data: data}
+
+	case blocks.Rail, blocks.PoweredRail, blocks.DetectorRail:
+		block.Data = player.railDirection(target, quadrant)
+
+	case blocks.WoodenDoor, blocks.IronDoor:
+		if face != geom.FaceTop {
+			return nil
+		}
+		return player.doorPlacements(block, target)
+
+	case blocks.Bed:
+		if face != geom.FaceTop {
+			return nil
+		}
+
+		offset := quadrantOffsets[quadrant]
+		head := BlockPos{target.X + offset.X, target.Y, target.Z + offset.Z}
+		if !player.getBlock(BlockPos{head.X, head.Y - 1, head.Z}).Solid() {
+			return nil
+		}
+
+		data := blocks.BlockData(quadrant)
+		return []placement{
+			{target, blocks.Block{Type: blocks.Bed, Data: data}},
+			{head, blocks.Block{Type: blocks.Bed, Data: data | blocks.BedUpper}},
+		}
+
+	case blocks.Slab:
+		// Slabs placed on the same kind of slab combine into one block
+		if below.Type == blocks.Slab && below.Data == block.Data {
+			return []placement{{
+				BlockPos{target.X, target.Y - 1, target.Z},
+				blocks.Block{Type: blocks.DoubleSlab, Data: block.Data},
+			}}
+		}
+	}
+
+	return []placement{{target, block}}
+}
+
+// Whether a block can be placed on top of the block below it
+func canStayOn(blockType blocks.BlockType, below blocks.Block, world BlockAccess, pos BlockPos) bool {
+	switch blockType {
+	case blocks.Sapling, blocks.Dandelion, blocks.Rose, blocks.TallGrass:
+		return below.Type == blocks.Grass || below.Type == blocks.Dirt || below.Type == blocks.Farmland
+
+	case blocks.DeadBush:
+		return below.Type == blocks.Sand
+
+	case blocks.Wheat:
+		return below.Type == blocks.Farmland
+
+	case blocks.Cactus:
+		return below.Type == blocks.Cactus || below.Type == blocks.Sand
+
+	case blocks.SugarCane:
+		if below.Type == blocks.SugarCane {
+			return true
+		}
+		if below.Type != blocks.Grass && below.Type != blocks.Dirt && below.Type != blocks.Sand {
+			return false
+		}
+
+		for _, offset := range quadrantOffsets {
+			water := world.GetBlock(pos.X+offset.X, pos.Y-1, pos.Z+offset.Z).Type
+			if water == blocks.Water || water == blocks.FlowingWater {
+				return true
+			}
+		}
+		return false
+
+	case blocks.BrownMushroom, blocks.RedMushroom, blocks.Redstone, blocks.RepeaterOff, blocks.Cake,
+		blocks.Rail, blocks.PoweredRail, blocks.DetectorRail, blocks.StonePressurePlate,
+		blocks.WoodPressurePlate, blocks.WoodenDoor, blocks.IronDoor, blocks.Bed, blocks.SnowLayer:
+		return below.Solid()
+
+	default:
+		return true
+	}
+}
+
+// Pistons face up or down when placed from above or below, otherwise they face
+// towards the player
+func (player *PlayerBase[S]) pistonFacing(target BlockPos, quadrant int) blocks.BlockData {
+	if math.Abs(player.x-float64(target.X)) < 2 && math.Abs(player.z-float64(target.Z)) < 2 {
+		height := player.y + 1.82
+		if height-float64(target.Y) > 2 {
+			return blocks.PistonUp
+		}
+		if float64(target.Y)-height > 0 {
+			return blocks.PistonDown
+		}
+	}
+
+	return [4]blocks.BlockData{blocks.PistonNorth, blocks.PistonEast, blocks.PistonSouth, blocks.PistonWest}[quadrant]
+}
+
+// Rails connect to neighboring rails if there are any along only one axis.
+// Otherwise, they run in the direction the player is facing.
+func (player *PlayerBase[S]) railDirection(target BlockPos, quadrant int) blocks.BlockData {
+	isRail := func(x, z int) bool {
+		switch player.Server.GetBlock(x, target.Y, z).Type {
+		case blocks.Rail, blocks.PoweredRail, blocks.DetectorRail:
+			return true
+		}
+		return false
+	}
+
+	alongX := isRail(target.X-1, target.Z) || isRail(target.X+1, target.Z)
+	alongZ := isRail(target.X, target.Z-1) || isRail(target.X, target.Z+1)
+
+	switch {
+	case alongX && !alongZ:
+		return blocks.RailWE
+	case alongZ && !alongX:
+		return blocks.RailNS
+	case quadrant%2 == 0:
+		return blocks.RailNS
+	default:
+		return blocks.RailWE
+	}
+}
+
+// Doors face away from the player. Like the vanilla game, a door is placed
+// open and rotated to look like it's hinged on the other side if that side is
+// next to another door or more solid blocks.
+func (player *PlayerBase[S]) doorPlacements(door blocks.Block, target BlockPos) []placement {
+	rotation := int(math.Floor(float64(player.yaw+180)*4/360-0.5)) & 3
+
+	side := quadrantOffsets[rotation]
+	solidCount := func(sign int) int {
+		count := 0
+		for dy := 0; dy < 2; dy++ {
+			if player.getBlock(BlockPos{target.X + side.X*sign, target.Y + dy, target.Z + side.Z*sign}).Solid() {
+				count++
+			}
+		}
+		return count
+	}
+	hasDoor := func(sign int) bool {
+		for dy := 0; dy < 2; dy++ {
+			if player.getBlock(BlockPos{target.X + side.X*sign, target.Y + dy, target.Z + side.Z*sign}).Type == door.Type {
+				return true
+			}
+		}
+		return false
+	}
+
+	data := blocks.BlockData(rotation)
+	doorLeft, doorRight := hasDoor(-1), hasDoor(1)
+	if (doorLeft && !doorRight) || solidCount(1) > solidCount(-1) {
+		data = blocks.BlockData((rotation-1)&3) | blocks.DoorOpen
+	}
+
+	return []placement{
+		{target, blocks.Block{Type: door.Type, Data: data}},
+		{BlockPos{target.X, target.Y + 1, target.Z}, blocks.Block{Type: door.Type, Data: data | blocks.DoorTop}},
+	}
+}
+
+// Whether every block can be placed without replacing a solid block, leaving
+// the world, or intersecting an entity
+func (player *PlayerBase[S]) canPlace(placements []placement) bool {
+	maxCoord := player.Server.ChunkDiameter() * 16
+
+	for _, placement := range placements {
+		pos := placement.pos
+		if pos.X < 0 || pos.X >= maxCoord || pos.Y < 0 || pos.Y >= 128 || pos.Z < 0 || pos.Z >= maxCoord {
+			return false
+		}
+
+		existing := player.getBlock(pos)
+		// Slabs are combined by replacing the slab below
+		combinesSlab := placement.block.Type == blocks.DoubleSlab && existing.Type == blocks.Slab
+		if !replaceable(existing) && !combinesSlab {
+			return false
+		}
+
+		offset := geom.Vec3{X: float64(pos.X), Y: float64(pos.Y), Z: float64(pos.Z)}
+		for _, box := range placement.block.CollisionBoxes() {
+			if player.entityInside(box.Offset(offset)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Whether the box intersects the hitbox of an entity that blocks placement.
+// Projectiles don't count.
+func (player *PlayerBase[S]) entityInside(box geom.AABB) bool {
+	area := box.Grow(entityWidth / 2)
+	// Entities are indexed by their feet
+	area.Min.Y -= entityHeight
+
+	candidates := player.Server.EntitiesInAABB(area.Min.X, area.Min.Y, area.Min.Z, area.Max.X, area.Max.Y, area.Max.Z)
+	for _, entity := range candidates {
+		if _, ok := entity.(Damageable); !ok {
+			continue
+		}
+
+		x, y, z := entity.Pos()
+		if geom.EntityAABB(geom.Vec3{X: x, Y: y, Z: z}, entityWidth, entityHeight).Intersects(box) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether placing a block removes the block that was there
+func replaceable(block blocks.Block) bool {
+	switch block.Type {
+	case blocks.Air, blocks.Water, blocks.FlowingWater, blocks.Lava, blocks.FlowingLava, blocks.Fire, blocks.SnowLayer:
+		return true
+	}
+	return false
+}
+
+func (player *PlayerBase[S]) getBlock(pos BlockPos) blocks.Block {
+	return player.Server.GetBlock(pos.X, pos.Y, pos.Z)
+}
@@ -0,0 +1,164 @@
+package oneworld
+
+import (
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/items"
+)
+
+// Creates a player holding a stack of the item who has been added to the
+// server
+func newPlacingPlayer(t *testing.T, item uint16) *PlayerBase[*Server] {
+	player, _ := newMovementPlayer(t)
+	player.Server.AddEntity(player)
+	player.items[hotbarSlotStart] = ItemStack{Id: item, Count: 2}
+	return player
+}
+
+func TestPlaceBlock(t *testing.T) {
+	player := newPlacingPlayer(t, uint16(blocks.Cobblestone))
+
+	if !player.PlaceHeldItem(12, movementFloorY, 8, 12, movementFloorY+1, 8) {
+		t.Fatal("placement failed")
+	}
+
+	if block := player.Server.GetBlock(12, movementFloorY+1, 8); block.Type != blocks.Cobblestone {
+		t.Fatalf("placed %v", block)
+	}
+
+	if count := player.HeldItem().Count; count != 1 {
+		t.Fatalf("stack has %d items left", count)
+	}
+}
+
+func TestPlaceIntoSolidBlock(t *testing.T) {
+	player := newPlacingPlayer(t, uint16(blocks.Cobblestone))
+
+	// The wall at x = 10
+	if player.PlaceHeldItem(10, movementFloorY+1, 8, 10, movementFloorY+2, 8) {
+		t.Fatal("replaced a solid block")
+	}
+
+	if count := player.HeldItem().Count; count != 2 {
+		t.Fatalf("stack has %d items left", count)
+	}
+}
+
+func TestPlaceIntoEntity(t *testing.T) {
+	player := newPlacingPlayer(t, uint16(blocks.Cobblestone))
+
+	// The player's legs
+	if player.PlaceHeldItem(8, movementFloorY, 8, 8, movementFloorY+1, 8) {
+		t.Fatal("placed a block inside the player")
+	}
+
+	// Torches have no collision box
+	player.items[hotbarSlotStart] = ItemStack{Id: uint16(blocks.Torch), Count: 1}
+	if !player.PlaceHeldItem(8, movementFloorY, 8, 8, movementFloorY+1, 8) {
+		t.Fatal("couldn't place a torch at the player's feet")
+	}
+}
+
+func TestPlacementOrientation(t *testing.T) {
+	tests := []struct {
+		name     string
+		item     uint16
+		yaw      float32
+		clicked  BlockPos
+		target   BlockPos
+		expected blocks.Block
+	}{
+		{
+			"stairs facing positive X", uint16(blocks.WoodStairs), 270,
+			BlockPos{12, movementFloorY, 8}, BlockPos{12, movementFloorY + 1, 8},
+			blocks.Block{Type: blocks.WoodStairs, Data: blocks.StairsEast},
+		},
+		{
+			"furnace placed facing positive Z", uint16(blocks.Furnace), 0,
+			BlockPos{8, movementFloorY, 12}, BlockPos{8, movementFloorY + 1, 12},
+			blocks.Block{Type: blocks.Furnace, Data: blocks.FurnaceNorth},
+		},
+		{
+			"pumpkin placed facing negative X", uint16(blocks.Pumpkin), 90,
+			BlockPos{6, movementFloorY, 8}, BlockPos{6, movementFloorY + 1, 8},
+			blocks.Block{Type: blocks.Pumpkin, Data: blocks.PumpkinEast},
+		},
+		{
+			"torch on wall", uint16(blocks.Torch), 270,
+			BlockPos{10, movementFloorY + 1, 8}, BlockPos{9, movementFloorY + 1, 8},
+			blocks.Block{Type: blocks.Torch, Data: blocks.TorchWest},
+		},
+		{
+			"ladder on wall", uint16(blocks.Ladder), 270,
+			BlockPos{10, movementFloorY + 2, 7}, BlockPos{9, movementFloorY + 2, 7},
+			blocks.Block{Type: blocks.Ladder, Data: blocks.LadderWest},
+		},
+		{
+			"lever on floor", uint16(blocks.Lever), 90,
+			BlockPos{12, movementFloorY, 8}, BlockPos{12, movementFloorY + 1, 8},
+			blocks.Block{Type: blocks.Lever, Data: blocks.LeverFloorWE},
+		},
+		{
+			"rail", uint16(blocks.Rail), 90,
+			BlockPos{12, movementFloorY, 8}, BlockPos{12, movementFloorY + 1, 8},
+			blocks.Block{Type: blocks.Rail, Data: blocks.RailWE},
+		},
+	}
+
+	for _, test := range tests {
+		player := newPlacingPlayer(t, test.item)
+		player.yaw = test.yaw
+
+		if !player.PlaceHeldItem(test.clicked.X, test.clicked.Y, test.clicked.Z, test.target.X, test.target.Y, test.target.Z) {
+			t.Errorf("%s: placement failed", test.name)
+			continue
+		}
+
+		if actual := player.getBlock(test.target); actual != test.expected {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestPlaceDoor(t *testing.T) {
+	player := newPlacingPlayer(t, uint16(items.Door))
+	player.yaw = 180
+
+	if !player.PlaceHeldItem(8, movementFloorY, 12, 8, movementFloorY+1, 12) {
+		t.Fatal("placement failed")
+	}
+
+	bottom := player.Server.GetBlock(8, movementFloorY+1, 12)
+	top := player.Server.GetBlock(8, movementFloorY+2, 12)
+	if bottom != (blocks.Block{Type: blocks.WoodenDoor, Data: 3}) || top != (blocks.Block{Type: blocks.WoodenDoor, Data: 3 | blocks.DoorTop}) {
+		t.Fatalf("placed %v and %v", bottom, top)
+	}
+}
+
+func TestPlaceBed(t *testing.T) {
+	player := newPlacingPlayer(t, uint16(items.Bed))
+
+	if !player.PlaceHeldItem(8, movementFloorY, 12, 8, movementFloorY+1, 12) {
+		t.Fatal("placement failed")
+	}
+
+	foot := player.Server.GetBlock(8, movementFloorY+1, 12)
+	head := player.Server.GetBlock(8, movementFloorY+1, 13)
+	if foot != (blocks.Block{Type: blocks.Bed, Data: blocks.BedNorth}) || head != (blocks.Block{Type: blocks.Bed, Data: blocks.BedNorth | blocks.BedUpper}) {
+		t.Fatalf("placed %v and %v", foot, head)
+	}
+}
+
+func TestCombineSlabs(t *testing.T) {
+	player := newPlacingPlayer(t, uint16(blocks.Slab))
+
+	player.PlaceHeldItem(12, movementFloorY, 8, 12, movementFloorY+1, 8)
+	if !player.PlaceHeldItem(12, movementFloorY+1, 8, 12, movementFloorY+2, 8) {
+		t.Fatal("placement failed")
+	}
+
+	if block := player.Server.GetBlock(12, movementFloorY+1, 8); block.Type != blocks.DoubleSlab {
+		t.Fatalf("slabs combined into %v", block)
+	}
+}
@@ -2,17 +2,39 @@ package oneworld
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/geom"
 	"github.com/richgrov/oneworld/internal/protocol"
 	"github.com/richgrov/oneworld/internal/util"
+	"github.com/richgrov/oneworld/items"
 )
 
 const packetBacklog = 32
+const maxHealth = 20
+
+// Distance from a player's feet to their eyes
+const playerEyeHeight = 1.62
+
+// Speed of thrown items such as snowballs, and of arrows shot from a fully
+// charged bow
+const throwSpeed = 1.5
+const maxBowSpeed = 3
+
+// Indices of inventory slots as numbered by the client's inventory window
+const (
+	armorSlotStart  = 5
+	armorSlotEnd    = 8
+	hotbarSlotStart = 36
+	hotbarSize      = 9
+)
 
 type PlayerBase[S playerServer] struct {
 	EntityBase
@@ -21,40 +43,112 @@ type PlayerBase[S playerServer] struct {
 
 	biomeSeed int64
 	dimension Dimension
-
-	reader              *bufio.Reader
-	conn                net.Conn
-	inboundPacketQueue  chan any
-	outboundPacketQueue chan []byte
+	// Whether the client has received the login packet
+	spawned bool
+	// Set when the player's existing data couldn't be loaded, in which case
+	// their data file is left untouched
+	loadErr error
+	// Frees the place the login filter held for the player while they joined
+	releaseLogin func()
+
+	reader             *bufio.Reader
+	conn               net.Conn
+	inboundPacketQueue chan any
+	outbound           *outboundQueue
+	// Chunks that weren't sent because the outbound queue was too full
+	droppedChunks map[ChunkPos]struct{}
+	// Block changes to send at the end of the tick, by chunk and then by
+	// position within the chunk
+	pendingBlockChanges map[ChunkPos]map[int16]blocks.Block
 	lastKeepAliveSent   time.Time
-	// When true, outboundPacketQueue is closed
+	// When true, outbound is closed
 	disconnected bool
+	// Set until the read and write loops are started. They're started once the
+	// player is added to a world, when the struct is at its final address,
+	// rather than in NewBasePlayer, which returns a copy.
+	loopsPending bool
+	// Closed when the write loop exits so that the read loop stops waiting for
+	// the tick loop
+	writeLoopDone chan struct{}
+	// Why the read loop stopped, if it wasn't because the connection closed.
+	// Only safe to read once inboundPacketQueue is closed.
+	readErr      error
 	eventHandler PlayerEventHandler
 
-	items    [45]ItemStack
-	viewDist int
+	items      [45]ItemStack
+	hotbarSlot byte
+	viewDist   int
+	sneaking   bool
+	health     int16
+
+	chargingBow   bool
+	bowChargeTime time.Time
+
+	digging         bool
+	digPos          BlockPos
+	digStartTime    time.Time
+	digExpectedTime time.Duration
+
+	movement          movementState
+	interactionChecks InteractionChecks
+
+	portal portalState
 }
 
 type playerServer interface {
 	ChunkDiameter() int
+	Chunk(chunkX, chunkZ int) *Chunk
+	Dimension() Dimension
+	Time() int64
+	Weather() Weather
+	PlayerDataDir() string
+	AddEntity(entity Entity)
+	RemoveEntity(id int32)
+	linkedWorld(dimension Dimension) (playerServer, bool)
+	entity(id int32) Entity
 	addChunkObserver(chunkX, chunkZ int, observer chunkObserver)
 	removeChunkObserver(chunkX, chunkZ int, observer chunkObserver)
+	LaunchProjectile(kind ProjectileType, shooterId int32, x, y, z, velocityX, velocityY, velocityZ float64) *Projectile
+	broadcast(entityId int32, packet protocol.OutboundPacket)
+	GetBlock(x, y, z int) blocks.Block
+	SetBlock(x, y, z int, block blocks.Block) bool
+	EntitiesInAABB(minX, minY, minZ, maxX, maxY, maxZ float64) []Entity
+	BlockCollisions(box geom.AABB) []geom.AABB
+	RaycastBlocks(ray geom.Ray, maxDistance float64) (BlockPos, float64, geom.Face, bool)
+	goroutines() *sync.WaitGroup
 }
 
 func (player *PlayerBase[S]) OnSpawned() {
-	player.queuePacket(&protocol.LoginPacket{
-		ProtocolVersion: player.id,
-		MapSeed:         player.biomeSeed,
-		Dimension:       byte(player.dimension),
-	})
+	if player.loopsPending {
+		player.startLoops(player.Server.goroutines())
+	}
 
-	player.queuePacket(&protocol.SetPositionPacket{
-		X:        player.x,
-		Y:        player.y,
-		Stance:   0,
-		Z:        player.z,
-		OnGround: false,
-	})
+	if player.spawned {
+		// The client unloads its world when the dimension changes
+		player.queuePacket(&protocol.RespawnPacket{Dimension: byte(player.dimension)})
+	} else {
+		player.queuePacket(&protocol.LoginPacket{
+			ProtocolVersion: player.id,
+			MapSeed:         player.biomeSeed,
+			Dimension:       byte(player.dimension),
+		})
+		player.spawned = true
+		// The player is counted as online now, so the login filter no longer
+		// needs to hold a place for them
+		if player.releaseLogin != nil {
+			player.releaseLogin()
+		}
+
+		if player.loadErr != nil {
+			player.eventHandler.OnError(fmt.Errorf("failed to load data of %s: %w", player.Username, player.loadErr))
+		}
+	}
+
+	player.queuePacket(&protocol.TimeUpdatePacket{Time: player.Server.Time()})
+	if player.Server.Weather() != WeatherClear {
+		player.queuePacket(rainPacket(true))
+	}
+	player.sendPosition()
 
 	chunkX := int(math.Floor(player.x / 16))
 	chunkZ := int(math.Floor(player.z / 16))
@@ -67,6 +161,11 @@ func (player *PlayerBase[S]) OnSpawned() {
 	}
 }
 
+// Creates the base of a player. The connection isn't used until the player is
+// added to a world. The player starts in dimension unless they have saved data,
+// in which case they start where they were last. If that isn't the server's
+// dimension, Server is set to the matching world of the server's universe, so
+// the player should be added to Server rather than the world passed in.
 func NewBasePlayer[S playerServer](
 	base EntityBase,
 	server S,
@@ -88,22 +187,58 @@ func NewBasePlayer[S playerServer](
 		biomeSeed: biomeSeed,
 		dimension: dimension,
 
+		releaseLogin:        conn.releaseLogin,
 		reader:              conn.reader,
 		conn:                conn.conn,
 		inboundPacketQueue:  make(chan any, packetBacklog),
-		outboundPacketQueue: make(chan []byte, packetBacklog),
+		outbound:            newOutboundQueue(DefaultOutboundLimits),
+		droppedChunks:       make(map[ChunkPos]struct{}),
+		pendingBlockChanges: make(map[ChunkPos]map[int16]blocks.Block),
 		disconnected:        false,
+		loopsPending:        true,
+		writeLoopDone:       make(chan struct{}),
 		eventHandler:        eventHandler,
 
 		viewDist: viewDistance,
+		health:   maxHealth,
+		movement: movementState{checks: DefaultMovementChecks},
+
+		interactionChecks: DefaultInteractionChecks,
+		portal:            portalState{left: true},
 	}
 
-	go player.readLoop()
-	go player.writeLoop()
+	player.loadErr = player.load()
+
+	if player.dimension != server.Dimension() {
+		if world, ok := player.linkedWorld(player.dimension); ok {
+			player.Server = world
+		} else {
+			// The dimension isn't hosted, so put the player at the
+			// equivalent position in this one
+			player.x, player.z = PortalCoordinates(player.x, player.z, player.dimension, server.Dimension())
+			player.dimension = server.Dimension()
+		}
+	}
 
 	return player
 }
 
+// Starts reading from and writing to the connection. The world waits for both
+// to finish when it shuts down.
+func (player *PlayerBase[S]) startLoops(group *sync.WaitGroup) {
+	player.loopsPending = false
+
+	group.Add(2)
+	go func() {
+		defer group.Done()
+		player.readLoop()
+	}()
+	go func() {
+		defer group.Done()
+		player.writeLoop()
+	}()
+}
+
 func (player *PlayerBase[S]) Tick() {
 	now := time.Now()
 	if now.Sub(player.lastKeepAliveSent).Seconds() > 20 {
@@ -114,29 +249,63 @@ func (player *PlayerBase[S]) Tick() {
 processPackets:
 	for {
 		select {
-		case packet := <-player.inboundPacketQueue:
+		case packet, ok := <-player.inboundPacketQueue:
+			if !ok {
+				if player.readErr != nil {
+					player.eventHandler.OnError(player.readErr)
+				}
+				player.remove()
+				player.Disconnect()
+				return
+			}
 			player.handlePacket(packet)
 		default:
 			break processPackets
 		}
 	}
+
+	player.resendDroppedChunks()
+
+	player.tickPortal()
 }
 
 // Teleports the player to the speicified coordinates. Will automatically
 // load/unload chunks as needed.
 func (player *PlayerBase[S]) Teleport(x float64, y float64, z float64) {
+	player.move(x, y, z)
+	player.sendPosition()
+}
+
+// Moves the client to the player's position on the server. Movement sent by
+// the client is ignored until it confirms the new position.
+func (player *PlayerBase[S]) sendPosition() {
 	player.queuePacket(&protocol.SetPositionPacket{
-		X:        x,
-		Y:        y,
-		Stance:   0,
-		Z:        z,
+		X: player.x,
+		// When sent by the server, the client reads Y as the position of the
+		// eyes and stance as the position of the feet
+		Y:        player.y + playerEyeHeight,
+		Stance:   player.y,
+		Z:        player.z,
 		OnGround: false,
 	})
+	player.movement.awaitingTeleport = true
+}
 
+// Updates the player's position and which chunks it observes
+func (player *PlayerBase[S]) move(x float64, y float64, z float64) {
 	chunkX := int(math.Floor(player.x / 16))
 	chunkZ := int(math.Floor(player.z / 16))
 	newChunkX := int(math.Floor(x / 16))
 	newChunkZ := int(math.Floor(z / 16))
+
+	player.x = x
+	player.y = y
+	player.z = z
+
+	if chunkX == newChunkX && chunkZ == newChunkZ {
+		return
+	}
+
 	maxChunk := player.Server.ChunkDiameter() - 1
 
 	for cx := util.IMax(chunkX-player.viewDist, 0); cx <= util.IMin(chunkX+player.viewDist, maxChunk); cx++ {
@@ -148,8 +317,8 @@ func (player *PlayerBase[S]) Teleport(x float64, y float64, z float64) {
 		}
 	}
 
-	for cx := newChunkX - player.viewDist; cx <= util.IMin(newChunkX+player.viewDist, maxChunk); cx++ {
-		for cz := newChunkZ - player.viewDist; cz <= util.IMin(newChunkZ+player.viewDist, maxChunk); cz++ {
+	for cx := util.IMax(newChunkX-player.viewDist, 0); cx <= util.IMin(newChunkX+player.viewDist, maxChunk); cx++ {
+		for cz := util.IMax(newChunkZ-player.viewDist, 0); cz <= util.IMin(newChunkZ+player.viewDist, maxChunk); cz++ {
 			sawChunkBefore := util.IAbs(cx-chunkX) <= player.viewDist && util.IAbs(cz-chunkZ) <= player.viewDist
 			if !sawChunkBefore {
 				player.Server.addChunkObserver(cx, cz, player)
@@ -158,6 +327,126 @@ func (player *PlayerBase[S]) Teleport(x float64, y float64, z float64) {
 	}
 }
 
+// Saves the player, stops observing all chunks, and removes the player from
+// the server
+func (player *PlayerBase[S]) remove() {
+	if err := player.Save(); err != nil {
+		player.eventHandler.OnError(err)
+	}
+
+	player.unobserveChunks()
+	player.Server.RemoveEntity(player.id)
+}
+
+// Stops observing all chunks around the player
+func (player *PlayerBase[S]) unobserveChunks() {
+	chunkX := int(math.Floor(player.x / 16))
+	chunkZ := int(math.Floor(player.z / 16))
+	maxChunk := player.Server.ChunkDiameter() - 1
+
+	for cx := util.IMax(chunkX-player.viewDist, 0); cx <= util.IMin(chunkX+player.viewDist, maxChunk); cx++ {
+		for cz := util.IMax(chunkZ-player.viewDist, 0); cz <= util.IMin(chunkZ+player.viewDist, maxChunk); cz++ {
+			player.Server.removeChunkObserver(cx, cz, player)
+		}
+	}
+}
+
+// Returns the world for the dimension in the universe of the player's current
+// world
+func (player *PlayerBase[S]) linkedWorld(dimension Dimension) (S, bool) {
+	if world, ok := player.Server.linkedWorld(dimension); ok {
+		linked, ok := world.(S)
+		return linked, ok
+	}
+
+	var none S
+	return none, false
+}
+
+// Moves the player to the coordinates in another world. The client is sent
+// to the world's dimension and receives all of its chunks again.
+func (player *PlayerBase[S]) ChangeWorld(world S, x, y, z float64) {
+	// Types that embed PlayerBase are what the world tracks
+	var entity Entity = player.Server.entity(player.id)
+	if entity == nil {
+		entity = player
+	}
+
+	player.unobserveChunks()
+	player.Server.RemoveEntity(player.id)
+
+	player.Server = world
+	player.dimension = world.Dimension()
+	player.x = x
+	player.y = y
+	player.z = z
+	player.movement.airborne = false
+	player.digging = false
+
+	world.AddEntity(entity)
+}
+
+func (*PlayerBase[S]) isPlayer() {}
+
+func (player *PlayerBase[S]) showTo(observer chunkObserver) {
+	var currentItem int16
+	if held := player.HeldItem(); !held.IsEmpty() {
+		currentItem = int16(held.Id)
+	}
+
+	observer.queuePacket(&protocol.NamedEntitySpawnPacket{
+		EntityId:    player.id,
+		Username:    player.Username,
+		X:           absoluteInt(player.x),
+		Y:           absoluteInt(player.y),
+		Z:           absoluteInt(player.z),
+		Yaw:         packedAngle(player.yaw),
+		Pitch:       packedAngle(player.pitch),
+		CurrentItem: currentItem,
+	})
+
+	for slot := armorSlotStart; slot <= armorSlotEnd; slot++ {
+		if !player.items[slot].IsEmpty() {
+			observer.queuePacket(player.equipmentPacket(byte(slot)))
+		}
+	}
+
+	if player.sneaking {
+		observer.queuePacket(&protocol.EntityMetadataPacket{
+			EntityId: player.id,
+			Metadata: player.metadata(),
+		})
+	}
+}
+
+func (player *PlayerBase[S]) metadata() protocol.Metadata {
+	var flags byte
+	if player.sneaking {
+		flags |= protocol.FlagCrouched
+	}
+
+	return protocol.Metadata{
+		{Index: protocol.MetadataFlags, Value: flags},
+	}
+}
+
+func (player *PlayerBase[S]) IsSneaking() bool {
+	return player.sneaking
+}
+
+func (player *PlayerBase[S]) setSneaking(sneaking bool) {
+	if player.sneaking == sneaking {
+		return
+	}
+	player.sneaking = sneaking
+
+	player.Server.broadcast(player.id, &protocol.EntityMetadataPacket{
+		EntityId: player.id,
+		Metadata: player.metadata(),
+	})
+	player.eventHandler.OnSneak(sneaking)
+}
+
 func (player *PlayerBase[S]) initializeChunk(chunkX int, chunkZ int) {
 	player.queuePacket(&protocol.PreChunkPacket{
 		ChunkX: int32(chunkX),
@@ -167,6 +456,8 @@ func (player *PlayerBase[S]) initializeChunk(chunkX int, chunkZ int) {
 }
 
 func (player *PlayerBase[S]) unloadChunk(chunkX int, chunkZ int) {
+	delete(player.droppedChunks, ChunkPos{chunkX, chunkZ})
+	delete(player.pendingBlockChanges, ChunkPos{chunkX, chunkZ})
 	player.queuePacket(&protocol.PreChunkPacket{
 		ChunkX: int32(chunkX),
 		ChunkZ: int32(chunkZ),
@@ -175,7 +466,13 @@ func (player *PlayerBase[S]) unloadChunk(chunkX int, chunkZ int) {
 }
 
 func (player *PlayerBase[S]) sendChunk(chunkX int, chunkZ int, ch *Chunk) {
-	player.queuePacket(&protocol.ChunkDataPacket{
+	if player.disconnected {
+		return
+	}
+	// The chunk already contains the changes
+	delete(player.pendingBlockChanges, ChunkPos{chunkX, chunkZ})
+
+	packet := &protocol.ChunkDataPacket{
 		StartX: int32(chunkX * 16),
 		StartY: 0,
 		StartZ: int32(chunkZ * 16),
@@ -183,13 +480,26 @@ func (player *PlayerBase[S]) sendChunk(chunkX int, chunkZ int, ch *Chunk) {
 		YSize:  127,
 		ZSize:  15,
 		Data:   ch.serializeToNetwork(),
-	})
+	}
+
+	if queued, retry := player.outbound.pushChunk(packet.Marshal()); queued {
+		return
+	} else if retry {
+		player.droppedChunks[ChunkPos{chunkX, chunkZ}] = struct{}{}
+	} else {
+		player.overflow()
+	}
 }
 
-// Can safely be called even if Disconnect() was already called
+// Can safely be called even if Disconnect() was already called. Never blocks,
+// and kicks the player if too many packets are waiting to be sent.
 func (player *PlayerBase[S]) queuePacket(packet protocol.OutboundPacket) {
-	if !player.disconnected {
-		player.outboundPacketQueue <- packet.Marshal()
+	if player.disconnected {
+		return
+	}
+
+	if !player.outbound.push(packet.Marshal()) {
+		player.overflow()
 	}
 }
 
@@ -198,8 +508,65 @@ func (player *PlayerBase[S]) handlePacket(packet any) {
 	case *protocol.ChatPacket:
 		player.eventHandler.OnChat(pkt.Message)
 
+	case *protocol.SetPositionPacket:
+		player.handleMovement(pkt.X, pkt.Y, pkt.Stance, pkt.Z)
+
+	case *protocol.SetAnglePacket:
+		player.yaw = pkt.Yaw
+		player.pitch = pkt.Pitch
+
+	case *protocol.SetAngleAndPositionPacket:
+		player.handleMovement(pkt.X, pkt.Y, pkt.Stance, pkt.Z)
+		player.yaw = pkt.Yaw
+		player.pitch = pkt.Pitch
+
+	case *protocol.SetHotbarSelectionPacket:
+		if pkt.Slot < 0 || pkt.Slot >= hotbarSize || byte(pkt.Slot) == player.hotbarSlot {
+			break
+		}
+
+		player.hotbarSlot = byte(pkt.Slot)
+		player.Server.broadcast(player.id, player.equipmentPacket(hotbarSlotStart+player.hotbarSlot))
+		player.eventHandler.OnHotbarChange(player.hotbarSlot)
+
+	case *protocol.EntityActionPacket:
+		switch pkt.State {
+		case protocol.ActionStartSneak:
+			player.setSneaking(true)
+		case protocol.ActionStopSneak:
+			player.setSneaking(false)
+		case protocol.ActionStopSleep:
+			player.Server.broadcast(player.id, &protocol.AnimationPacket{
+				EntityId: player.id,
+				Animate:  protocol.AnimationLeaveBed,
+			})
+			player.eventHandler.OnLeaveBed()
+		}
+
+	case *protocol.AnimationPacket:
+		if pkt.Animate == protocol.AnimationSwingArm {
+			player.Server.broadcast(player.id, &protocol.AnimationPacket{
+				EntityId: player.id,
+				Animate:  protocol.AnimationSwingArm,
+			})
+			player.eventHandler.OnSwingArm()
+		}
+
 	case *protocol.DigPacket:
-		player.eventHandler.OnDig(int(pkt.X), int(pkt.Y), int(pkt.Z), pkt.Status == 2)
+		if pkt.Status == protocol.DigReleaseItem {
+			player.releaseBow()
+			break
+		}
+
+		x, y, z := int(pkt.X), int(pkt.Y), int(pkt.Z)
+		if (pkt.Status == protocol.DigStarted || pkt.Status == protocol.DigFinished) &&
+			!player.canInteract(x, y, z, geom.Face(pkt.Face)) {
+			// The client may have already broken the block
+			player.SendBlockChange(x, y, z, player.Server.GetBlock(x, y, z))
+			break
+		}
+
+		player.eventHandler.OnDig(x, y, z, player.validateDig(pkt.Status, x, y, z))
 
 	case *protocol.UseItemPacket:
 		if pkt.ItemId != -1 {
@@ -221,50 +588,196 @@ func (player *PlayerBase[S]) handlePacket(packet any) {
 			case protocol.PositiveX:
 				x++
 			case protocol.None:
+				player.useHeldItem()
 				player.eventHandler.OnInteractAir()
 				return
 			}
 
+			if !player.canInteract(int(pkt.X), int(pkt.Y), int(pkt.Z), geom.Face(pkt.Direction)) {
+				// Undo the block and item the client placed
+				player.SendBlockChange(int(x), int(y), int(z), player.Server.GetBlock(int(x), int(y), int(z)))
+				player.syncSlot(hotbarSlotStart + player.hotbarSlot)
+				return
+			}
+
 			player.eventHandler.OnInteractBlock(int(pkt.X), int(pkt.Y), int(pkt.Z), int(x), int(y), int(z))
 		}
 	}
 }
 
+// Throws or starts charging the held item if it's a projectile or bow
+func (player *PlayerBase[S]) useHeldItem() {
+	held := player.HeldItem()
+	if held.IsEmpty() {
+		return
+	}
+
+	slot := hotbarSlotStart + player.hotbarSlot
+
+	switch items.ItemId(held.Id) {
+	case items.Snowball:
+		player.LaunchProjectile(SnowballProjectile, throwSpeed)
+		player.consumeItem(slot)
+
+	case items.Egg:
+		player.LaunchProjectile(EggProjectile, throwSpeed)
+		player.consumeItem(slot)
+
+	case items.Bow:
+		if player.findItem(items.Arrow) != -1 {
+			player.chargingBow = true
+			player.bowChargeTime = time.Now()
+		}
+	}
+}
+
+// Shoots an arrow with a speed depending on how long the bow was charged
+func (player *PlayerBase[S]) releaseBow() {
+	if !player.chargingBow {
+		return
+	}
+	player.chargingBow = false
+
+	if items.ItemId(player.HeldItem().Id) != items.Bow {
+		return
+	}
+
+	arrowSlot := player.findItem(items.Arrow)
+	if arrowSlot == -1 {
+		return
+	}
+
+	charge := time.Since(player.bowChargeTime).Seconds()
+	power := math.Min((charge*charge+charge*2)/3, 1)
+	if power < 0.1 {
+		return
+	}
+
+	player.LaunchProjectile(ArrowProjectile, power*maxBowSpeed)
+	player.consumeItem(byte(arrowSlot))
+}
+
+// Launches a projectile from the player's eyes in the direction they're
+// looking
+func (player *PlayerBase[S]) LaunchProjectile(kind ProjectileType, speed float64) *Projectile {
+	yaw := float64(player.yaw) * math.Pi / 180
+	pitch := float64(player.pitch) * math.Pi / 180
+
+	return player.Server.LaunchProjectile(
+		kind,
+		player.id,
+		player.x, player.y+playerEyeHeight, player.z,
+		-math.Sin(yaw)*math.Cos(pitch)*speed,
+		-math.Sin(pitch)*speed,
+		math.Cos(yaw)*math.Cos(pitch)*speed,
+	)
+}
+
+// Returns the first inventory slot containing the item, or -1 if there is none
+func (player *PlayerBase[S]) findItem(id items.ItemId) int {
+	for slot := range player.items {
+		if items.ItemId(player.items[slot].Id) == id && !player.items[slot].IsEmpty() {
+			return slot
+		}
+	}
+	return -1
+}
+
+// Removes one item from the stack in the slot
+func (player *PlayerBase[S]) consumeItem(slot byte) {
+	item := player.items[slot]
+	item.Count--
+	if item.Count == 0 {
+		item = ItemStack{}
+	}
+	player.SetItem(slot, &item)
+}
+
+func (player *PlayerBase[S]) Health() int16 {
+	return player.health
+}
+
+func (player *PlayerBase[S]) Damage(amount int16, knockbackX, knockbackY, knockbackZ float64) {
+	if player.health <= 0 {
+		return
+	}
+
+	player.health -= amount
+	if player.health < 0 {
+		player.health = 0
+	}
+
+	player.queuePacket(&protocol.UpdateHealthPacket{Health: player.health})
+	player.movement.knockbackGrace = knockbackGraceUpdates
+	player.queuePacket(&protocol.EntityVelocityPacket{
+		EntityId:  player.id,
+		VelocityX: packedVelocity(knockbackX),
+		VelocityY: packedVelocity(knockbackY),
+		VelocityZ: packedVelocity(knockbackZ),
+	})
+	player.Server.broadcast(player.id, &protocol.AnimationPacket{
+		EntityId: player.id,
+		Animate:  protocol.AnimationDamage,
+	})
+}
+
+// Only the tick loop may close the outbound queue, so the read and write
+// loops close the connection instead and leave the rest to it
 func (player *PlayerBase[S]) readLoop() {
-	defer player.Disconnect()
+	defer player.conn.Close()
+	// Signals the tick loop to remove the player
+	defer close(player.inboundPacketQueue)
 
 	for {
 		packet, err := protocol.ReadNextPacket(player.reader)
 		if err != nil {
-			fmt.Printf("%s\n", err)
+			// Closing the connection ends the loop normally
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				player.readErr = err
+			}
 			break
 		}
-		player.inboundPacketQueue <- packet
+		select {
+		case player.inboundPacketQueue <- packet:
+		case <-player.writeLoopDone:
+			// The tick loop may have stopped, so nothing will read the packet
+			return
+		}
 	}
 }
 
 func (player *PlayerBase[S]) writeLoop() {
+	defer close(player.writeLoopDone)
+	defer player.conn.Close()
+
+	// Packets are written in batches to avoid a system call for each one
+	writer := bufio.NewWriterSize(player.conn, writeBufferSize)
+
 	for {
-		data, ok := <-player.outboundPacketQueue
+		packets, ok := player.outbound.take()
 		if !ok {
-			break
+			// Everything queued before the queue was closed has been sent
+			return
 		}
 
-		_, err := player.conn.Write(data)
-		if err != nil {
-			player.Disconnect()
+		// A client that stops reading would otherwise block forever
+		if timeout := player.outbound.writeTimeout(); timeout > 0 {
+			player.conn.SetWriteDeadline(time.Now().Add(timeout))
 		}
-	}
-}
 
-func (player *PlayerBase[S]) SendBlockChange(x int, y int, z int, block blocks.Block) {
-	player.queuePacket(&protocol.BlockChangePacket{
-		X:    int32(x),
-		Y:    byte(y),
-		Z:    int32(z),
-		Type: byte(block.Type),
-		Data: byte(block.Data),
-	})
+		for _, packet := range packets {
+			if _, err := writer.Write(packet); err != nil {
+				player.outbound.discard(packets)
+				return
+			}
+		}
+
+		if err := writer.Flush(); err != nil {
+			player.outbound.discard(packets)
+			return
+		}
+		player.outbound.sent(packets)
+	}
 }
 
 func (player *PlayerBase[S]) Message(message string) {
@@ -279,23 +792,99 @@ func (player *PlayerBase[S]) GetItemInSlot(slot byte) *ItemStack {
 
 func (player *PlayerBase[S]) SetItem(slot byte, item *ItemStack) {
 	player.items[slot] = *item
-	player.queuePacket(&protocol.SetSlotPacket{
-		WindowId:  0,
-		Slot:      int16(slot),
-		ItemId:    int16(item.Id),
-		StackSize: item.Count,
-		Damage:    int16(item.Damage),
-	})
+	player.syncSlot(slot)
+
+	if slot == hotbarSlotStart+player.hotbarSlot || (slot >= armorSlotStart && slot <= armorSlotEnd) {
+		player.Server.broadcast(player.id, player.equipmentPacket(slot))
+	}
+}
+
+// Sends the contents of the inventory slot to the client
+func (player *PlayerBase[S]) syncSlot(slot byte) {
+	item := &player.items[slot]
+	packet := &protocol.SetSlotPacket{
+		WindowId: 0,
+		Slot:     int16(slot),
+		ItemId:   -1,
+	}
+
+	if !item.IsEmpty() {
+		packet.ItemId = int16(item.Id)
+		packet.StackSize = item.Count
+		packet.Damage = int16(item.Damage)
+	}
+	player.queuePacket(packet)
+}
+
+// Returns the index of the selected hotbar slot, from 0 to 8
+func (player *PlayerBase[S]) HotbarSlot() byte {
+	return player.hotbarSlot
+}
+
+// Returns the item in the selected hotbar slot
+func (player *PlayerBase[S]) HeldItem() *ItemStack {
+	return &player.items[hotbarSlotStart+player.hotbarSlot]
+}
+
+// Creates a packet showing the item in the inventory slot, which must be
+// either the held item or armor
+func (player *PlayerBase[S]) equipmentPacket(slot byte) *protocol.EntityEquipmentPacket {
+	equipmentSlot := protocol.EquipmentHeld
+	if slot >= armorSlotStart && slot <= armorSlotEnd {
+		// Armor slots go from helmet to boots, but equipment slots go from
+		// boots to helmet
+		equipmentSlot = int16(armorSlotEnd + 1 - slot)
+	}
+
+	item := &player.items[slot]
+	packet := &protocol.EntityEquipmentPacket{
+		EntityId: player.id,
+		Slot:     equipmentSlot,
+		ItemId:   -1,
+		Damage:   0,
+	}
+
+	if !item.IsEmpty() {
+		packet.ItemId = int16(item.Id)
+		packet.Damage = int16(item.Damage)
+	}
+	return packet
 }
 
 // Can safely be called more than once
 func (player *PlayerBase[S]) Disconnect() {
-	println("Disconnecting", player.Username)
 	player.conn.Close()
 
 	if !player.disconnected {
-		close(player.outboundPacketQueue)
+		player.outbound.close()
+	}
+	player.disconnected = true
+}
+
+// Closes the connection without waiting for queued packets to be sent
+func (player *PlayerBase[S]) closeConnection() {
+	if player.conn != nil {
+		player.conn.Close()
 	}
+}
+
+// Disconnects the player after sending them the reason, which is shown on
+// their screen. Packets queued before this are still sent.
+func (player *PlayerBase[S]) Kick(reason string) {
+	if player.disconnected {
+		return
+	}
+
+	player.flushBlockChanges()
+	if player.disconnected {
+		// The queue overflowed while flushing, which already kicked the player
+		return
+	}
+
+	// Sent even if the queue is full
+	player.outbound.forcePush(protocol.NewKick(reason).Marshal())
+	// The write loop closes the connection once the queue is empty
+	player.outbound.close()
 	player.disconnected = true
 }
 
@@ -303,5 +892,17 @@ type PlayerEventHandler interface {
 	OnChat(message string)
 	OnInteractBlock(clickedX, clickedY, clickedZ, newX, newY, newZ int)
 	OnInteractAir()
+	// finishedDestroying is true once the player has dug the block for long
+	// enough to break it with the item they're holding
 	OnDig(x, y, z int, finishedDestroying bool)
+	OnHotbarChange(slot byte)
+	OnSneak(sneaking bool)
+	OnSwingArm()
+	OnLeaveBed()
+	// Called when the player moves in a way that isn't allowed. They will
+	// have already been moved back to their last valid position.
+	OnViolation(violation Violation)
+	// Called when the player's data couldn't be loaded or saved, or their
+	// connection failed
+	OnError(err error)
 }
@@ -0,0 +1,346 @@
+package oneworld
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+func TestKickSendsQueuedPackets(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	player.conn = serverConn
+	player.writeLoopDone = make(chan struct{})
+	go player.writeLoop()
+
+	player.Message("goodbye")
+	player.Kick("Kicked by an operator")
+	// Further packets are dropped
+	player.Message("hello")
+
+	reader := bufio.NewReader(clientConn)
+	var chat protocol.ChatPacket
+	if err := protocol.ExpectPacket(reader, protocol.ChatId, &chat); err != nil || chat.Message != "goodbye" {
+		t.Fatalf("expected chat message but got %q, %v", chat.Message, err)
+	}
+
+	var kick protocol.DisconnectPacket
+	if err := protocol.ExpectPacket(reader, protocol.DisconnectId, &kick); err != nil || kick.Message != "Kicked by an operator" {
+		t.Fatalf("expected kick but got %q, %v", kick.Message, err)
+	}
+
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Fatalf("connection wasn't closed: %v", err)
+	}
+}
+
+// Adds a player connected through a pipe to the server and returns the
+// client's end of the connection
+func newConnectedPlayer(t *testing.T, server *Server) net.Conn {
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+
+	conn := &AcceptedConnection{
+		Username: "Notch",
+		reader:   bufio.NewReader(serverConn),
+		conn:     serverConn,
+	}
+	base := NewBasePlayer(server.AllocateEntity(8.5, 20, 8.5), server, conn, 1, 0, Overworld, new(violationRecorder))
+	player := &base
+	server.AddEntity(player)
+	return clientConn
+}
+
+func TestShutdownKicksPlayers(t *testing.T) {
+	server := newEmptyServer(t)
+	clientConn := newConnectedPlayer(t, server)
+
+	received := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(clientConn)
+		received <- data
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client's connection is closed after the kick
+	data := <-received
+	kick := protocol.NewKick(shutdownMessage).Marshal()
+	if !bytes.HasSuffix(data, kick) {
+		t.Fatalf("last packet wasn't a kick: %v", data[len(data)-len(kick):])
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	server := newEmptyServer(t)
+	// The client never reads, so nothing can be sent
+	newConnectedPlayer(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline to be exceeded but got %v", err)
+	}
+}
+
+func TestShutdownTimeoutReportsSaveError(t *testing.T) {
+	server := newEmptyServer(t)
+	// The level can't be saved in a directory that is a file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	server.levelPath = filepath.Join(file, "level.dat")
+	newConnectedPlayer(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	var pathErr *fs.PathError
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &pathErr) {
+		t.Fatalf("expected both errors but got %v", err)
+	}
+}
+
+func TestShutdownStopsListener(t *testing.T) {
+	server := newEmptyServer(t)
+	listener := newTestListener(t)
+	server.SetListener(listener)
+	// Makes sure that the listener is running
+	ping := dialListener(t, listener, []byte{protocol.ServerListPingId})
+	expectKick(t, ping.reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-listener.runDone:
+	default:
+		t.Fatal("listener is still running")
+	}
+
+	if conn, err := net.Dial("tcp", listener.listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("connection was accepted after shutdown")
+	}
+}
+
+func TestWaitForGoroutinesTimeout(t *testing.T) {
+	var group sync.WaitGroup
+	// Never finishes until the end of the test
+	group.Add(1)
+	defer group.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	canceled := false
+	result := make(chan error)
+	go func() {
+		result <- waitForGoroutines(ctx, &group, func() { canceled = true })
+	}()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline to be exceeded but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("kept waiting after the context was done")
+	}
+
+	if !canceled {
+		t.Fatal("goroutines weren't told to stop")
+	}
+}
+
+// Creates a player with another player next to them that can see them
+func newObservedPlayer(t *testing.T) (*PlayerBase[*Server], *PlayerBase[*Server]) {
+	player, _ := newMovementPlayer(t)
+	player.Server.AddEntity(player)
+
+	observer := newTestPlayer(t, player.Server, 9.5, movementFloorY+1, 8.5, new(violationRecorder))
+	player.Server.AddEntity(observer)
+
+	queuedPackets(player)
+	queuedPackets(observer)
+	return player, observer
+}
+
+// Checks that the packets include the expected packet
+func expectPacket(t *testing.T, packets [][]byte, expected protocol.OutboundPacket) {
+	t.Helper()
+	data := expected.Marshal()
+	for _, packet := range packets {
+		if bytes.Equal(packet, data) {
+			return
+		}
+	}
+	t.Fatalf("%T %+v wasn't sent", expected, expected)
+}
+
+func sneakMetadata(player *PlayerBase[*Server], flags byte) *protocol.EntityMetadataPacket {
+	return &protocol.EntityMetadataPacket{
+		EntityId: player.Id(),
+		Metadata: protocol.Metadata{{Index: protocol.MetadataFlags, Value: flags}},
+	}
+}
+
+func TestSneakShownToObservers(t *testing.T) {
+	player, observer := newObservedPlayer(t)
+
+	player.handlePacket(&protocol.EntityActionPacket{EntityId: player.Id(), State: protocol.ActionStartSneak})
+	if !player.IsSneaking() {
+		t.Fatal("player isn't sneaking")
+	}
+	expectPacket(t, queuedPackets(observer), sneakMetadata(player, protocol.FlagCrouched))
+
+	// Players that see them afterwards are told they're sneaking when they
+	// spawn
+	late := newTestPlayer(t, player.Server, 7.5, movementFloorY+1, 8.5, new(violationRecorder))
+	player.Server.AddEntity(late)
+	expectPacket(t, queuedPackets(late), sneakMetadata(player, protocol.FlagCrouched))
+
+	player.handlePacket(&protocol.EntityActionPacket{EntityId: player.Id(), State: protocol.ActionStopSneak})
+	expectPacket(t, queuedPackets(observer), sneakMetadata(player, 0))
+
+	// Players aren't sent their own metadata
+	for _, packet := range queuedPackets(player) {
+		if packet[0] == protocol.EntityMetadataId {
+			t.Fatal("player was sent their own metadata")
+		}
+	}
+}
+
+func TestAnimationsShownToObservers(t *testing.T) {
+	player, observer := newObservedPlayer(t)
+
+	player.handlePacket(&protocol.AnimationPacket{EntityId: player.Id(), Animate: protocol.AnimationSwingArm})
+	expectPacket(t, queuedPackets(observer), &protocol.AnimationPacket{EntityId: player.Id(), Animate: protocol.AnimationSwingArm})
+
+	player.handlePacket(&protocol.EntityActionPacket{EntityId: player.Id(), State: protocol.ActionStopSleep})
+	expectPacket(t, queuedPackets(observer), &protocol.AnimationPacket{EntityId: player.Id(), Animate: protocol.AnimationLeaveBed})
+
+	// Only arm swings are relayed from the client
+	player.handlePacket(&protocol.AnimationPacket{EntityId: player.Id(), Animate: protocol.AnimationDamage})
+	if packets := queuedPackets(observer); len(packets) != 0 {
+		t.Fatalf("relayed %d packets", len(packets))
+	}
+}
+
+func TestEquipmentSlots(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+
+	tests := []struct {
+		slot     byte
+		expected int16
+	}{
+		{armorSlotStart, protocol.EquipmentHelmet},
+		{armorSlotStart + 1, protocol.EquipmentChestplate},
+		{armorSlotStart + 2, protocol.EquipmentLeggings},
+		{armorSlotEnd, protocol.EquipmentBoots},
+		{hotbarSlotStart, protocol.EquipmentHeld},
+		{hotbarSlotStart + hotbarSize - 1, protocol.EquipmentHeld},
+	}
+
+	for _, test := range tests {
+		if actual := player.equipmentPacket(test.slot).Slot; actual != test.expected {
+			t.Errorf("inventory slot %d: expected equipment slot %d but got %d", test.slot, test.expected, actual)
+		}
+	}
+}
+
+func TestEquipmentShownToObservers(t *testing.T) {
+	player, observer := newObservedPlayer(t)
+
+	player.SetItem(armorSlotStart, &ItemStack{Id: 310, Count: 1})
+	expectPacket(t, queuedPackets(observer), &protocol.EntityEquipmentPacket{
+		EntityId: player.Id(),
+		Slot:     protocol.EquipmentHelmet,
+		ItemId:   310,
+	})
+
+	player.SetItem(hotbarSlotStart+1, &ItemStack{Id: 276, Damage: 5, Count: 1})
+	// Not the held item
+	if packets := queuedPackets(observer); len(packets) != 0 {
+		t.Fatalf("sent %d packets for an item that isn't held", len(packets))
+	}
+
+	player.handlePacket(&protocol.SetHotbarSelectionPacket{Slot: 1})
+	if held := player.HeldItem(); held.Id != 276 || player.HotbarSlot() != 1 {
+		t.Fatalf("holding %+v in slot %d", held, player.HotbarSlot())
+	}
+	expectPacket(t, queuedPackets(observer), &protocol.EntityEquipmentPacket{
+		EntityId: player.Id(),
+		Slot:     protocol.EquipmentHeld,
+		ItemId:   276,
+		Damage:   5,
+	})
+
+	// Empty hands are sent as -1
+	player.handlePacket(&protocol.SetHotbarSelectionPacket{Slot: 2})
+	expectPacket(t, queuedPackets(observer), &protocol.EntityEquipmentPacket{
+		EntityId: player.Id(),
+		Slot:     protocol.EquipmentHeld,
+		ItemId:   -1,
+	})
+
+	// Out of range
+	player.handlePacket(&protocol.SetHotbarSelectionPacket{Slot: hotbarSize})
+	if player.HotbarSlot() != 2 {
+		t.Fatalf("selected slot %d", player.HotbarSlot())
+	}
+
+	// Players that see them afterwards are sent their armor
+	late := newTestPlayer(t, player.Server, 7.5, movementFloorY+1, 8.5, new(violationRecorder))
+	player.Server.AddEntity(late)
+	expectPacket(t, queuedPackets(late), &protocol.EntityEquipmentPacket{
+		EntityId: player.Id(),
+		Slot:     protocol.EquipmentHelmet,
+		ItemId:   310,
+	})
+}
+
+func TestReadErrorReported(t *testing.T) {
+	for _, test := range []struct {
+		data     []byte
+		reported bool
+	}{
+		// Only the server sends time updates
+		{[]byte{protocol.TimeUpdateId}, true},
+		// The client closed the connection
+		{nil, false},
+	} {
+		player, recorder := newMovementPlayer(t)
+		player.Server.AddEntity(player)
+		player.reader = bufio.NewReader(bytes.NewReader(test.data))
+		player.readLoop()
+
+		player.Tick()
+		if reported := len(recorder.errors) == 1; reported != test.reported || len(recorder.errors) > 1 {
+			t.Errorf("reading %v reported %v", test.data, recorder.errors)
+		}
+		if player.Server.entity(player.Id()) != nil {
+			t.Error("player wasn't removed")
+		}
+	}
+}
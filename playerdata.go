@@ -0,0 +1,239 @@
+package oneworld
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// How often players are saved, in ticks
+const autosaveInterval = 5 * 60 * ticksPerSecond
+
+// Slots in saved inventories are numbered differently from those in the
+// inventory window
+const (
+	savedHotbarStart = 0
+	// The main inventory has the same numbers in both
+	savedMainStart = 9
+	savedMainEnd   = 35
+	// Boots are saved in slot 100 and the helmet in 103
+	savedArmorStart = 100
+	savedArmorEnd   = 103
+)
+
+// Air a player has when they aren't underwater, in ticks
+const maxAir = 300
+
+// Layout of the players/<username>.dat files written by the vanilla server.
+// Every tag the vanilla server reads is written so that it can load the files,
+// with defaults for state that isn't simulated here. Tags that aren't listed
+// are ignored when loading, so they're lost when a vanilla file is saved again.
+type playerData struct {
+	Inventory []savedItem
+	Pos       []float64
+	// Vanilla reads all three elements without checking that they exist
+	Motion       []float64
+	Rotation     []float32
+	FallDistance float32
+	// Ticks left burning
+	Fire       int16
+	Air        int16
+	OnGround   byte
+	Health     int16
+	HurtTime   int16
+	DeathTime  int16
+	AttackTime int16
+	Dimension  int32
+	Sleeping   byte
+	SleepTimer int16
+}
+
+type savedItem struct {
+	Slot   byte
+	Id     int16 `nbt:"id"`
+	Count  byte
+	Damage int16
+}
+
+// Sets the directory that player data is loaded from and saved to, usually
+// the players directory of a world. Player data isn't saved if this is empty.
+// Worlds in a universe share the directory, so setting it for one sets it for
+// all of them.
+func (server *Server) SetPlayerDataDir(dir string) {
+	if server.universe != nil {
+		server.universe.playerDataDir = dir
+		return
+	}
+	server.playerDataDir = dir
+}
+
+func (server *Server) PlayerDataDir() string {
+	if server.universe != nil {
+		return server.universe.playerDataDir
+	}
+	return server.playerDataDir
+}
+
+// Sets the directory that player data is loaded from and saved to for every
+// world, like the single players directory of a vanilla save
+func (universe *Universe) SetPlayerDataDir(dir string) {
+	universe.playerDataDir = dir
+}
+
+// Saves every player on the server. Players are still saved if saving another
+// fails, and the first error is returned.
+func (server *Server) SavePlayers() error {
+	var firstErr error
+	for _, tracked := range server.entities {
+		if saver, ok := tracked.entity.(playerSaver); ok {
+			if err := saver.Save(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+type playerSaver interface {
+	Save() error
+}
+
+func validUsername(username string) bool {
+	if len(username) == 0 {
+		return false
+	}
+
+	for _, c := range username {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the path of the player's data file, or an empty string if player
+// data isn't saved
+func (player *PlayerBase[S]) dataPath() (string, error) {
+	dir := player.Server.PlayerDataDir()
+	if dir == "" {
+		return "", nil
+	}
+
+	// Prevent names like ../level from writing elsewhere
+	if !validUsername(player.Username) {
+		return "", fmt.Errorf("can't save data for player with invalid name %q", player.Username)
+	}
+
+	return filepath.Join(dir, player.Username+".dat"), nil
+}
+
+// Loads the player's inventory, position, health, and dimension. Does nothing
+// if the player has no saved data.
+func (player *PlayerBase[S]) load() error {
+	path, err := player.dataPath()
+	if path == "" || err != nil {
+		return err
+	}
+
+	var data playerData
+	if found, err := readCompressedNBT(path, &data); err != nil || !found {
+		return err
+	}
+
+	if len(data.Pos) != 3 || len(data.Rotation) != 2 {
+		return fmt.Errorf("failed to read %s: expected 3 coordinates and 2 angles but got %d and %d", path, len(data.Pos), len(data.Rotation))
+	}
+
+	for _, saved := range data.Inventory {
+		slot, ok := windowSlot(saved.Slot)
+		if !ok {
+			continue
+		}
+
+		player.items[slot] = ItemStack{
+			Id:     uint16(saved.Id),
+			Damage: uint16(saved.Damage),
+			Count:  saved.Count,
+		}
+	}
+
+	player.x = data.Pos[0]
+	player.y = data.Pos[1]
+	player.z = data.Pos[2]
+	player.yaw = data.Rotation[0]
+	player.pitch = data.Rotation[1]
+	// Players that died before leaving would otherwise spawn dead
+	if data.Health > 0 {
+		player.health = data.Health
+	}
+	player.dimension = Dimension(data.Dimension)
+	return nil
+}
+
+// Writes the player's data to disk if a player data directory is set
+func (player *PlayerBase[S]) Save() error {
+	if player.loadErr != nil {
+		return fmt.Errorf("not saving %s because their existing data couldn't be loaded", player.Username)
+	}
+
+	path, err := player.dataPath()
+	if path == "" || err != nil {
+		return err
+	}
+
+	data := playerData{
+		Inventory: make([]savedItem, 0),
+		Pos:       []float64{player.x, player.y, player.z},
+		Motion:    []float64{0, 0, 0},
+		Rotation:  []float32{player.yaw, player.pitch},
+		Air:       maxAir,
+		OnGround:  boolByte(player.movement.onGround),
+		Health:    player.health,
+		Dimension: int32(player.dimension),
+	}
+
+	for slot := range player.items {
+		item := &player.items[slot]
+		saved, ok := savedSlot(byte(slot))
+		if !ok || item.IsEmpty() {
+			continue
+		}
+
+		data.Inventory = append(data.Inventory, savedItem{
+			Slot:   saved,
+			Id:     int16(item.Id),
+			Count:  item.Count,
+			Damage: int16(item.Damage),
+		})
+	}
+
+	return writeCompressedNBT(path, data)
+}
+
+// Converts a slot number in the inventory window to the one used in saved
+// data. Crafting slots aren't saved.
+func savedSlot(slot byte) (byte, bool) {
+	switch {
+	case slot >= hotbarSlotStart && slot < hotbarSlotStart+hotbarSize:
+		return slot - hotbarSlotStart + savedHotbarStart, true
+	case slot >= savedMainStart && slot <= savedMainEnd:
+		return slot, true
+	case slot >= armorSlotStart && slot <= armorSlotEnd:
+		return savedArmorEnd - (slot - armorSlotStart), true
+	default:
+		return 0, false
+	}
+}
+
+// Converts a slot number in saved data to the one used by the inventory window
+func windowSlot(saved byte) (byte, bool) {
+	switch {
+	case saved < savedHotbarStart+hotbarSize:
+		return saved - savedHotbarStart + hotbarSlotStart, true
+	case saved >= savedMainStart && saved <= savedMainEnd:
+		return saved, true
+	case saved >= savedArmorStart && saved <= savedArmorEnd:
+		return armorSlotStart + (savedArmorEnd - saved), true
+	default:
+		return 0, false
+	}
+}
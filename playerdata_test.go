@@ -0,0 +1,157 @@
+package oneworld
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/richgrov/oneworld/nbt"
+)
+
+func TestSaveAndLoadPlayer(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	player.Server.SetPlayerDataDir(filepath.Join(t.TempDir(), "players"))
+	player.Username = "Notch"
+
+	player.x, player.y, player.z = 1.5, 20, -3.25
+	player.yaw, player.pitch = 90, -30
+	player.health = 7
+	player.dimension = Nether
+	player.items[hotbarSlotStart+2] = ItemStack{Id: 276, Damage: 12, Count: 1}
+	player.items[20] = ItemStack{Id: 4, Count: 64}
+	player.items[armorSlotStart] = ItemStack{Id: 310, Count: 1}
+
+	if err := player.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, _ := newMovementPlayer(t)
+	loaded.Server = player.Server
+	loaded.Username = player.Username
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.x != player.x || loaded.y != player.y || loaded.z != player.z {
+		t.Errorf("loaded position %f %f %f", loaded.x, loaded.y, loaded.z)
+	}
+	if loaded.yaw != player.yaw || loaded.pitch != player.pitch {
+		t.Errorf("loaded angle %f %f", loaded.yaw, loaded.pitch)
+	}
+	if loaded.health != player.health || loaded.dimension != player.dimension {
+		t.Errorf("loaded health %d and dimension %d", loaded.health, loaded.dimension)
+	}
+	if loaded.items != player.items {
+		t.Errorf("loaded items %v", loaded.items)
+	}
+}
+
+// Decodes a saved player data file
+func readPlayerFile(t *testing.T, path string) playerData {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	decompressor, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data playerData
+	if err := nbt.Unmarshal(bufio.NewReader(decompressor), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSavedInventoryLayout(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	dir := t.TempDir()
+	player.Server.SetPlayerDataDir(dir)
+	player.Username = "Notch"
+
+	player.items[hotbarSlotStart] = ItemStack{Id: 1, Count: 1}
+	player.items[armorSlotStart] = ItemStack{Id: 310, Count: 1}
+	if err := player.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := readPlayerFile(t, filepath.Join(dir, "Notch.dat"))
+	expected := []savedItem{{Slot: 103, Id: 310, Count: 1}, {Slot: 0, Id: 1, Count: 1}}
+	if len(data.Inventory) != 2 || data.Inventory[0] != expected[0] || data.Inventory[1] != expected[1] {
+		t.Fatalf("expected %v but got %v", expected, data.Inventory)
+	}
+}
+
+func TestSavedEntityTags(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	dir := t.TempDir()
+	player.Server.SetPlayerDataDir(dir)
+	player.Username = "Notch"
+	player.movement.onGround = true
+
+	if err := player.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Vanilla fails to load files without a motion vector
+	data := readPlayerFile(t, filepath.Join(dir, "Notch.dat"))
+	if len(data.Motion) != 3 {
+		t.Errorf("saved motion %v", data.Motion)
+	}
+	if data.Air != maxAir || data.OnGround != 1 || data.Fire != 0 || data.FallDistance != 0 {
+		t.Errorf("saved air %d, on ground %d, fire %d, and fall distance %f", data.Air, data.OnGround, data.Fire, data.FallDistance)
+	}
+}
+
+func TestDeadPlayerLoadedAlive(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	player.Server.SetPlayerDataDir(t.TempDir())
+	player.health = 0
+	if err := player.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestPlayer(t, player.Server, 8.5, movementFloorY+1, 8.5, new(violationRecorder))
+	if loaded.health != maxHealth {
+		t.Fatalf("loaded health %d", loaded.health)
+	}
+}
+
+func TestLoadErrorReported(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Notch.dat"), []byte("not gzip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	player.Server.SetPlayerDataDir(dir)
+
+	recorder := new(violationRecorder)
+	loaded := newTestPlayer(t, player.Server, 8.5, movementFloorY+1, 8.5, recorder)
+	if len(recorder.errors) != 0 {
+		t.Fatal("error was reported before the player spawned")
+	}
+
+	player.Server.AddEntity(loaded)
+	if len(recorder.errors) != 1 {
+		t.Fatalf("reported %v", recorder.errors)
+	}
+	if err := loaded.Save(); err == nil {
+		t.Fatal("data that couldn't be loaded was overwritten")
+	}
+}
+
+func TestInvalidUsernameNotSaved(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	player.Server.SetPlayerDataDir(t.TempDir())
+	player.Username = "../level"
+
+	if err := player.Save(); err == nil {
+		t.Fatal("saved player with invalid name")
+	}
+}
@@ -0,0 +1,133 @@
+package oneworld
+
+import (
+	"math"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/util"
+)
+
+// Number of ticks a player must stand in a portal before traveling
+const portalDelayTicks = 80
+
+// How far away from the destination, in blocks, an existing portal is used
+// instead of building a new one
+const portalSearchRadius = 16
+
+type portalState struct {
+	ticks int
+	// False after traveling until the player steps out of the portal they
+	// arrived in, so that they aren't sent straight back
+	left bool
+}
+
+func (player *PlayerBase[S]) inPortal() bool {
+	x := int(math.Floor(player.x))
+	y := int(math.Floor(player.y))
+	z := int(math.Floor(player.z))
+	return player.Server.GetBlock(x, y, z).Type == blocks.Portal ||
+		player.Server.GetBlock(x, y+1, z).Type == blocks.Portal
+}
+
+func (player *PlayerBase[S]) tickPortal() {
+	if !player.inPortal() {
+		player.portal.ticks = 0
+		player.portal.left = true
+		return
+	}
+
+	if !player.portal.left {
+		return
+	}
+
+	player.portal.ticks++
+	if player.portal.ticks >= portalDelayTicks {
+		player.portal.ticks = 0
+		player.travelThroughPortal()
+	}
+}
+
+// Sends the player to the Nether, or to the Overworld if they're already in
+// the Nether. Does nothing if the destination isn't hosted.
+func (player *PlayerBase[S]) travelThroughPortal() {
+	target := Nether
+	if player.dimension == Nether {
+		target = Overworld
+	}
+
+	world, ok := player.linkedWorld(target)
+	if !ok {
+		return
+	}
+
+	x, z := PortalCoordinates(player.x, player.z, player.dimension, target)
+	maxCoord := world.ChunkDiameter()*16 - 1
+	blockX := util.IClamp(int(math.Floor(x)), 0, maxCoord)
+	blockZ := util.IClamp(int(math.Floor(z)), 0, maxCoord)
+
+	pos, ok := findPortal(world, blockX, blockZ)
+	if !ok {
+		pos = buildPortal(world, blockX, blockZ)
+	}
+
+	player.portal.left = false
+	player.ChangeWorld(world, float64(pos.X)+0.5, float64(pos.Y), float64(pos.Z)+0.5)
+}
+
+// Returns the bottom of the closest portal to the column, if there is one
+func findPortal(world playerServer, x, z int) (BlockPos, bool) {
+	maxCoord := world.ChunkDiameter()*16 - 1
+	var closest BlockPos
+	closestDist := -1
+
+	for px := util.IClamp(x-portalSearchRadius, 0, maxCoord); px <= util.IClamp(x+portalSearchRadius, 0, maxCoord); px++ {
+		for pz := util.IClamp(z-portalSearchRadius, 0, maxCoord); pz <= util.IClamp(z+portalSearchRadius, 0, maxCoord); pz++ {
+			dist := (px-x)*(px-x) + (pz-z)*(pz-z)
+			if closestDist != -1 && dist >= closestDist {
+				continue
+			}
+
+			for y := 1; y < 128; y++ {
+				if world.GetBlock(px, y, pz).Type == blocks.Portal && world.GetBlock(px, y-1, pz).Type != blocks.Portal {
+					closest = BlockPos{px, y, pz}
+					closestDist = dist
+					break
+				}
+			}
+		}
+	}
+
+	return closest, closestDist != -1
+}
+
+// Builds an obsidian frame filled with portal blocks along the X axis and
+// returns the position of its bottom. The portal is placed on the highest
+// floor in the column with room above it.
+func buildPortal(world playerServer, x, z int) BlockPos {
+	// The frame extends one block past each side of the portal
+	x = util.IClamp(x, 1, world.ChunkDiameter()*16-3)
+
+	y := 64
+	for top := 123; top > 0; top-- {
+		if world.GetBlock(x, top-1, z).Solid() && !world.GetBlock(x, top, z).Solid() &&
+			!world.GetBlock(x, top+1, z).Solid() && !world.GetBlock(x, top+2, z).Solid() {
+			y = top
+			break
+		}
+	}
+
+	obsidian := blocks.Block{Type: blocks.Obsidian}
+	for fx := x - 1; fx <= x+2; fx++ {
+		world.SetBlock(fx, y-1, z, obsidian)
+		world.SetBlock(fx, y+3, z, obsidian)
+	}
+
+	for fy := y; fy <= y+2; fy++ {
+		world.SetBlock(x-1, fy, z, obsidian)
+		world.SetBlock(x+2, fy, z, obsidian)
+		world.SetBlock(x, fy, z, blocks.Block{Type: blocks.Portal})
+		world.SetBlock(x+1, fy, z, blocks.Block{Type: blocks.Portal})
+	}
+
+	return BlockPos{x, y, z}
+}
@@ -0,0 +1,241 @@
+package oneworld
+
+import (
+	"math"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/geom"
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+type ProjectileType byte
+
+const (
+	ArrowProjectile    = ProjectileType(protocol.ObjectArrow)
+	SnowballProjectile = ProjectileType(protocol.ObjectSnowball)
+	EggProjectile      = ProjectileType(protocol.ObjectEgg)
+)
+
+const (
+	projectileDrag      = 0.99
+	projectileWaterDrag = 0.8
+	arrowGravity        = 0.05
+	thrownGravity       = 0.03
+	// Number of ticks after launch during which a projectile can't hit its
+	// shooter, so it doesn't hit them as soon as it leaves their hand
+	shooterImmunityTicks = 5
+	arrowDespawnTicks    = 1200
+	// How often the velocity is resent to correct the client's simulation
+	projectileVelocitySyncInterval = 20
+	// Projectiles that fall this far below the world are removed
+	projectileMinY = -64
+	// How much entity hitboxes are grown by when testing for projectile hits
+	projectileHitboxGrowth = 0.3
+)
+
+// An arrow, snowball, or egg affected by gravity and drag. Projectiles are
+// removed after hitting an entity, except for arrows which stick in blocks
+// they hit.
+type Projectile struct {
+	EntityBase
+	server    *Server
+	kind      ProjectileType
+	shooterId int32
+
+	velocityX float64
+	velocityY float64
+	velocityZ float64
+
+	age      int
+	inGround bool
+}
+
+// Spawns a projectile with the given velocity in blocks per tick. shooterId is
+// the entity that launched the projectile, or -1 if there is none.
+func (server *Server) LaunchProjectile(
+	kind ProjectileType,
+	shooterId int32,
+	x, y, z float64,
+	velocityX, velocityY, velocityZ float64,
+) *Projectile {
+	projectile := &Projectile{
+		EntityBase: server.AllocateEntity(x, y, z),
+		server:     server,
+		kind:       kind,
+		shooterId:  shooterId,
+
+		velocityX: velocityX,
+		velocityY: velocityY,
+		velocityZ: velocityZ,
+	}
+	projectile.faceVelocity()
+
+	server.AddEntity(projectile)
+	return projectile
+}
+
+func (projectile *Projectile) Kind() ProjectileType {
+	return projectile.kind
+}
+
+func (projectile *Projectile) Velocity() (float64, float64, float64) {
+	return projectile.velocityX, projectile.velocityY, projectile.velocityZ
+}
+
+func (projectile *Projectile) Tick() {
+	projectile.age++
+
+	if projectile.inGround {
+		if projectile.age > arrowDespawnTicks {
+			projectile.server.RemoveEntity(projectile.id)
+		}
+		return
+	}
+
+	movement := geom.Ray{
+		Origin:    geom.Vec3{X: projectile.x, Y: projectile.y, Z: projectile.z},
+		Direction: geom.Vec3{X: projectile.velocityX, Y: projectile.velocityY, Z: projectile.velocityZ},
+	}
+
+	_, blockDistance, _, hitBlock := projectile.server.RaycastBlocks(movement, 1)
+	if !hitBlock {
+		blockDistance = 1
+	}
+
+	if target := projectile.findEntityHit(movement, blockDistance); target != nil {
+		projectile.hitEntity(target)
+		return
+	}
+
+	newPos := movement.At(blockDistance)
+	projectile.x = newPos.X
+	projectile.y = newPos.Y
+	projectile.z = newPos.Z
+
+	if hitBlock {
+		if projectile.kind != ArrowProjectile {
+			projectile.server.RemoveEntity(projectile.id)
+			return
+		}
+
+		projectile.inGround = true
+		projectile.age = 0
+		projectile.velocityX = 0
+		projectile.velocityY = 0
+		projectile.velocityZ = 0
+		projectile.syncVelocity()
+		return
+	}
+
+	drag := projectileDrag
+	block := projectile.server.GetBlock(int(math.Floor(projectile.x)), int(math.Floor(projectile.y)), int(math.Floor(projectile.z)))
+	if block.Type == blocks.Water || block.Type == blocks.FlowingWater {
+		drag = projectileWaterDrag
+	}
+
+	gravity := thrownGravity
+	if projectile.kind == ArrowProjectile {
+		gravity = arrowGravity
+	}
+
+	projectile.velocityX *= drag
+	projectile.velocityY = projectile.velocityY*drag - gravity
+	projectile.velocityZ *= drag
+	projectile.faceVelocity()
+
+	if projectile.age%projectileVelocitySyncInterval == 0 {
+		projectile.syncVelocity()
+	}
+
+	if projectile.y < projectileMinY {
+		projectile.server.RemoveEntity(projectile.id)
+	}
+}
+
+// Returns the closest damageable entity hit by the ray before maxDistance
+func (projectile *Projectile) findEntityHit(ray geom.Ray, maxDistance float64) Damageable {
+	var closest Damageable
+	closestDistance := maxDistance
+
+	searchArea := geom.NewAABB(ray.Origin.X, ray.Origin.Y, ray.Origin.Z, ray.Origin.X, ray.Origin.Y, ray.Origin.Z).
+		Expand(ray.Direction.Scale(maxDistance)).
+		Grow(entityWidth/2 + projectileHitboxGrowth)
+	// Entities are indexed by their feet, so extend downwards to find ones
+	// whose body is in the way
+	searchArea.Min.Y -= entityHeight
+
+	candidates := projectile.server.EntitiesInAABB(
+		searchArea.Min.X, searchArea.Min.Y, searchArea.Min.Z,
+		searchArea.Max.X, searchArea.Max.Y, searchArea.Max.Z,
+	)
+
+	for _, entity := range candidates {
+		id := entity.Id()
+		if id == projectile.id || (id == projectile.shooterId && projectile.age < shooterImmunityTicks) {
+			continue
+		}
+
+		target, ok := entity.(Damageable)
+		if !ok {
+			continue
+		}
+
+		x, y, z := target.Pos()
+		hitbox := geom.EntityAABB(geom.Vec3{X: x, Y: y, Z: z}, entityWidth, entityHeight).Grow(projectileHitboxGrowth)
+		if distance, _, hit := hitbox.IntersectRay(ray, closestDistance); hit {
+			closest = target
+			closestDistance = distance
+		}
+	}
+
+	return closest
+}
+
+func (projectile *Projectile) hitEntity(target Damageable) {
+	var damage int16
+	if projectile.kind == ArrowProjectile {
+		speed := math.Sqrt(projectile.velocityX*projectile.velocityX + projectile.velocityY*projectile.velocityY + projectile.velocityZ*projectile.velocityZ)
+		damage = int16(math.Ceil(speed * 2))
+	}
+
+	var knockbackX, knockbackZ float64
+	horizontalSpeed := math.Sqrt(projectile.velocityX*projectile.velocityX + projectile.velocityZ*projectile.velocityZ)
+	if horizontalSpeed > 0 {
+		knockbackX = projectile.velocityX / horizontalSpeed * 0.6
+		knockbackZ = projectile.velocityZ / horizontalSpeed * 0.6
+	}
+
+	target.Damage(damage, knockbackX, 0.1, knockbackZ)
+	projectile.server.RemoveEntity(projectile.id)
+}
+
+func (projectile *Projectile) faceVelocity() {
+	horizontalSpeed := math.Sqrt(projectile.velocityX*projectile.velocityX + projectile.velocityZ*projectile.velocityZ)
+	projectile.yaw = float32(math.Atan2(projectile.velocityX, projectile.velocityZ) * 180 / math.Pi)
+	projectile.pitch = float32(math.Atan2(projectile.velocityY, horizontalSpeed) * 180 / math.Pi)
+}
+
+func (projectile *Projectile) velocityPacket() *protocol.EntityVelocityPacket {
+	return &protocol.EntityVelocityPacket{
+		EntityId:  projectile.id,
+		VelocityX: packedVelocity(projectile.velocityX),
+		VelocityY: packedVelocity(projectile.velocityY),
+		VelocityZ: packedVelocity(projectile.velocityZ),
+	}
+}
+
+func (projectile *Projectile) syncVelocity() {
+	projectile.server.broadcast(projectile.id, projectile.velocityPacket())
+}
+
+func (projectile *Projectile) showTo(observer chunkObserver) {
+	observer.queuePacket(&protocol.AddObjectPacket{
+		EntityId:  projectile.id,
+		Type:      byte(projectile.kind),
+		X:         absoluteInt(projectile.x),
+		Y:         absoluteInt(projectile.y),
+		Z:         absoluteInt(projectile.z),
+		ThrowerId: 0,
+	})
+	observer.queuePacket(projectile.velocityPacket())
+}
@@ -0,0 +1,197 @@
+package oneworld
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+	"github.com/richgrov/oneworld/items"
+)
+
+// An entity that records the last time it was damaged
+type damageRecorder struct {
+	EntityBase
+	hits       int
+	damage     int16
+	knockbackX float64
+	knockbackY float64
+	knockbackZ float64
+}
+
+func (recorder *damageRecorder) Damage(amount int16, knockbackX, knockbackY, knockbackZ float64) {
+	recorder.hits++
+	recorder.damage = amount
+	recorder.knockbackX = knockbackX
+	recorder.knockbackY = knockbackY
+	recorder.knockbackZ = knockbackZ
+}
+
+func expectNear(t *testing.T, name string, actual, expected float64) {
+	t.Helper()
+	if math.Abs(actual-expected) > 1e-9 {
+		t.Errorf("expected %s to be %f but got %f", name, expected, actual)
+	}
+}
+
+func TestProjectileGravityAndDrag(t *testing.T) {
+	server := newEmptyServer(t)
+
+	tests := []struct {
+		kind    ProjectileType
+		gravity float64
+	}{
+		{SnowballProjectile, thrownGravity},
+		{ArrowProjectile, arrowGravity},
+	}
+
+	for _, test := range tests {
+		projectile := server.LaunchProjectile(test.kind, -1, 8, 100, 8, 0.5, 0.2, -0.1)
+		projectile.Tick()
+
+		x, y, z := projectile.Pos()
+		expectNear(t, "x", x, 8.5)
+		expectNear(t, "y", y, 100.2)
+		expectNear(t, "z", z, 7.9)
+
+		velocityX, velocityY, velocityZ := projectile.Velocity()
+		expectNear(t, "x velocity", velocityX, 0.5*projectileDrag)
+		expectNear(t, "y velocity", velocityY, 0.2*projectileDrag-test.gravity)
+		expectNear(t, "z velocity", velocityZ, -0.1*projectileDrag)
+	}
+}
+
+func TestProjectileWaterDrag(t *testing.T) {
+	server := newEmptyServer(t)
+	server.SetBlock(8, 100, 8, blocks.Block{Type: blocks.Water})
+
+	projectile := server.LaunchProjectile(SnowballProjectile, -1, 8.5, 100.5, 7.5, 0, 0, 1)
+	projectile.Tick()
+
+	if _, _, velocityZ := projectile.Velocity(); velocityZ != projectileWaterDrag {
+		t.Fatalf("z velocity is %f", velocityZ)
+	}
+}
+
+// Creates a world with a stone floor whose top is at y = 11
+func newFloorServer(t *testing.T) *Server {
+	server := newEmptyServer(t)
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			server.SetBlock(x, 10, z, blocks.Block{Type: blocks.Stone})
+		}
+	}
+	return server
+}
+
+func TestArrowSticksInBlock(t *testing.T) {
+	server := newFloorServer(t)
+	arrow := server.LaunchProjectile(ArrowProjectile, -1, 8.5, 11.5, 8.5, 0, -1, 0)
+	arrow.Tick()
+
+	if _, y, _ := arrow.Pos(); math.Abs(y-11) > 1e-9 {
+		t.Fatalf("arrow stopped at y=%f", y)
+	}
+	if !arrow.inGround {
+		t.Fatal("arrow isn't stuck in the ground")
+	}
+	if velocityX, velocityY, velocityZ := arrow.Velocity(); velocityX != 0 || velocityY != 0 || velocityZ != 0 {
+		t.Fatalf("arrow is still moving at %f, %f, %f", velocityX, velocityY, velocityZ)
+	}
+
+	// Arrows in the ground stay still until they despawn
+	for i := 0; i < arrowDespawnTicks; i++ {
+		arrow.Tick()
+	}
+	if server.entity(arrow.Id()) == nil {
+		t.Fatal("arrow despawned early")
+	}
+	arrow.Tick()
+	if server.entity(arrow.Id()) != nil {
+		t.Fatal("arrow didn't despawn")
+	}
+}
+
+func TestSnowballBreaksOnBlock(t *testing.T) {
+	server := newFloorServer(t)
+	snowball := server.LaunchProjectile(SnowballProjectile, -1, 8.5, 11.5, 8.5, 0, -1, 0)
+	snowball.Tick()
+
+	if server.entity(snowball.Id()) != nil {
+		t.Fatal("snowball wasn't removed")
+	}
+}
+
+func TestProjectileHitsEntity(t *testing.T) {
+	server := newEmptyServer(t)
+	target := &damageRecorder{EntityBase: server.AllocateEntity(10, 64, 8)}
+	server.AddEntity(target)
+
+	arrow := server.LaunchProjectile(ArrowProjectile, -1, 8, 65, 8, 1.5, 0, 0)
+	arrow.Tick()
+
+	if target.hits != 1 {
+		t.Fatalf("target was hit %d times", target.hits)
+	}
+	// Twice the speed, rounded up
+	if target.damage != 3 {
+		t.Errorf("target took %d damage", target.damage)
+	}
+	expectNear(t, "x knockback", target.knockbackX, 0.6)
+	expectNear(t, "y knockback", target.knockbackY, 0.1)
+	expectNear(t, "z knockback", target.knockbackZ, 0)
+
+	if server.entity(arrow.Id()) != nil {
+		t.Fatal("arrow wasn't removed")
+	}
+
+	// Snowballs only push
+	snowball := server.LaunchProjectile(SnowballProjectile, -1, 10, 65, 6, 0, 0, 1.5)
+	snowball.Tick()
+
+	if target.hits != 2 || target.damage != 0 {
+		t.Fatalf("snowball hit %d times for %d damage", target.hits-1, target.damage)
+	}
+	expectNear(t, "x knockback", target.knockbackX, 0)
+	expectNear(t, "z knockback", target.knockbackZ, 0.6)
+}
+
+func TestProjectileMissesShooter(t *testing.T) {
+	server := newEmptyServer(t)
+	shooter := &damageRecorder{EntityBase: server.AllocateEntity(8.5, 64, 8.5)}
+	server.AddEntity(shooter)
+
+	snowball := server.LaunchProjectile(SnowballProjectile, shooter.Id(), 8.5, 65.62, 8.5, 0, 0, 0.5)
+	snowball.Tick()
+
+	if shooter.hits != 0 {
+		t.Fatal("projectile hit its shooter")
+	}
+	if server.entity(snowball.Id()) == nil {
+		t.Fatal("projectile was removed")
+	}
+}
+
+func TestThrowLastSnowball(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	player.items[hotbarSlotStart] = ItemStack{Id: uint16(items.Snowball), Count: 1}
+
+	player.useHeldItem()
+
+	if !player.HeldItem().IsEmpty() {
+		t.Fatalf("player still holds %+v", player.HeldItem())
+	}
+
+	// Empty slots are sent with an item ID of -1 rather than 0
+	empty := (&protocol.SetSlotPacket{Slot: hotbarSlotStart, ItemId: -1}).Marshal()
+	for _, packet := range queuedPackets(player) {
+		if packet[0] == protocol.SetSlotId {
+			if !bytes.Equal(packet, empty) {
+				t.Fatalf("expected %v but got %v", empty, packet)
+			}
+			return
+		}
+	}
+	t.Fatal("slot wasn't sent")
+}
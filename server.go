@@ -1,11 +1,18 @@
 package oneworld
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+	"github.com/richgrov/oneworld/internal/util"
 )
 
 const protocolVersion = 14
@@ -18,23 +25,61 @@ type Server struct {
 	// main tick loop.
 	messageQueue chan func()
 
-	entities     map[int32]Entity
-	nextEntityId int32
+	entities map[int32]*trackedEntity
+	// Players among the entities. Read from other goroutines, such as the
+	// listener's.
+	onlinePlayers atomic.Int32
+	// Shared with the other worlds in the universe
+	nextEntityId *int32
+	// Goroutines of the players' connections. Also shared with the universe
+	// because players move between worlds.
+	goroutineGroup *sync.WaitGroup
 
 	chunks        []*Chunk
 	entityTracker []indexedEntities
 	chunkDiameter int
+
+	ticks         int
+	playerDataDir string
+	levelPath     string
+	level         levelData
+
+	time     int64
+	timeRate int64
+	weather  weatherState
+	random   *rand.Rand
+
+	dimension Dimension
+	universe  *Universe
+	// Shut down before the world so that no players join while it stops
+	listener *Listener
 }
 
 type indexedEntities struct {
 	observers []chunkObserver
+	entities  []Entity
 }
 
 type chunkObserver interface {
+	Id() int32
 	initializeChunk(chunkX, chunkZ int)
 	unloadChunk(chunkX, chunkZ int)
 	sendChunk(chunkX, chunkZ int, chunk *Chunk)
 	SendBlockChange(x, y, z int, block blocks.Block)
+	queuePacket(packet protocol.OutboundPacket)
+}
+
+// The last state of an entity that was sent to observers
+type trackedEntity struct {
+	entity Entity
+	chunkX int
+	chunkZ int
+
+	x     float64
+	y     float64
+	z     float64
+	yaw   float32
+	pitch float32
 }
 
 func NewServer(chunkDiameter int, chunks []*Chunk) (*Server, error) {
@@ -52,6 +97,7 @@ func NewServer(chunkDiameter int, chunks []*Chunk) (*Server, error) {
 	for i := range entityIndices {
 		entityIndices[i] = indexedEntities{
 			observers: make([]chunkObserver, 0),
+			entities:  make([]Entity, 0),
 		}
 	}
 
@@ -59,12 +105,17 @@ func NewServer(chunkDiameter int, chunks []*Chunk) (*Server, error) {
 		ticker:       time.NewTicker(time.Second / ticksPerSecond),
 		messageQueue: make(chan func(), messageQueueBacklog),
 
-		entities:     make(map[int32]Entity),
-		nextEntityId: 0,
+		entities:     make(map[int32]*trackedEntity),
+		nextEntityId: new(int32),
+
+		goroutineGroup: new(sync.WaitGroup),
 
 		chunks:        chunks,
 		entityTracker: entityIndices,
 		chunkDiameter: chunkDiameter,
+
+		timeRate: 1,
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 
 	return server, nil
@@ -74,17 +125,102 @@ func (server *Server) ChunkDiameter() int {
 	return server.chunkDiameter
 }
 
+func (server *Server) Dimension() Dimension {
+	return server.dimension
+}
+
+// Returns the world for the dimension in the same universe, or nil if there is
+// none. Worlds that aren't part of a universe only return themselves.
+func (server *Server) World(dimension Dimension) *Server {
+	if server.universe != nil {
+		return server.universe.World(dimension)
+	}
+
+	if dimension == server.dimension {
+		return server
+	}
+	return nil
+}
+
+func (server *Server) linkedWorld(dimension Dimension) (playerServer, bool) {
+	world := server.World(dimension)
+	return world, world != nil
+}
+
+// Returns the entity with the ID, or nil if it isn't in this world
+func (server *Server) entity(id int32) Entity {
+	if tracked, ok := server.entities[id]; ok {
+		return tracked.entity
+	}
+	return nil
+}
+
 func (server *Server) AddEntity(entity Entity) {
-	server.entities[entity.Id()] = entity
+	x, y, z := entity.Pos()
+	yaw, pitch := entity.Angle()
+	chunkX, chunkZ := server.trackingChunk(x, z)
+
+	server.entities[entity.Id()] = &trackedEntity{
+		entity: entity,
+		chunkX: chunkX,
+		chunkZ: chunkZ,
+
+		x:     x,
+		y:     y,
+		z:     z,
+		yaw:   yaw,
+		pitch: pitch,
+	}
+
+	if _, ok := entity.(playerEntity); ok {
+		server.onlinePlayers.Add(1)
+	}
+
+	index := server.indexedEntities(chunkX, chunkZ)
+	index.entities = append(index.entities, entity)
+	for _, observer := range index.observers {
+		if observer.Id() != entity.Id() {
+			entity.showTo(observer)
+		}
+	}
+
 	entity.OnSpawned()
 }
 
+// Removes the entity from the world and hides it from all observers. Does
+// nothing if the entity doesn't exist.
+func (server *Server) RemoveEntity(id int32) {
+	tracked, ok := server.entities[id]
+	if !ok {
+		return
+	}
+	delete(server.entities, id)
+	if _, ok := tracked.entity.(playerEntity); ok {
+		server.onlinePlayers.Add(-1)
+	}
+
+	index := server.indexedEntities(tracked.chunkX, tracked.chunkZ)
+	index.removeEntity(id)
+
+	destroy := &protocol.DestroyEntityPacket{EntityId: id}
+	for _, observer := range index.observers {
+		if observer.Id() != id {
+			observer.queuePacket(destroy)
+		}
+	}
+}
+
+// Returns the number of players in the world. Safe to call from any goroutine.
+func (server *Server) OnlinePlayers() int {
+	return int(server.onlinePlayers.Load())
+}
+
 func (server *Server) AllocateEntity(x, y, z float64) EntityBase {
-	id := server.nextEntityId
+	id := *server.nextEntityId
 	if id == math.MaxInt32 {
 		panic("entity IDs exhausted")
 	}
-	server.nextEntityId++
+	*server.nextEntityId++
 
 	return EntityBase{
 		id: id,
@@ -101,6 +237,30 @@ func (server *Server) Ticker() <-chan time.Time {
 func (server *Server) Tick() {
 	server.drainMessageQueue()
 	server.tickEntities()
+	server.trackEntityMovement()
+	server.tickTime()
+	server.tickWeather()
+	server.flushPackets()
+
+	server.ticks++
+	if server.ticks%autosaveInterval == 0 {
+		if err := server.Save(); err != nil {
+			fmt.Printf("failed to save world: %s\n", err)
+		}
+	}
+}
+
+type packetFlusher interface {
+	flushPackets()
+}
+
+// Sends every player the packets queued for them during the tick
+func (server *Server) flushPackets() {
+	for _, tracked := range server.entities {
+		if player, ok := tracked.entity.(packetFlusher); ok {
+			player.flushPackets()
+		}
+	}
 }
 
 func (server *Server) drainMessageQueue() {
@@ -115,11 +275,102 @@ func (server *Server) drainMessageQueue() {
 }
 
 func (server *Server) tickEntities() {
-	for _, entity := range server.entities {
-		entity.Tick()
+	for _, tracked := range server.entities {
+		tracked.entity.Tick()
 	}
 }
 
+// Moves entities between chunk indices and notifies observers of any entities
+// that have moved since the last tick
+func (server *Server) trackEntityMovement() {
+	for _, tracked := range server.entities {
+		x, y, z := tracked.entity.Pos()
+		yaw, pitch := tracked.entity.Angle()
+
+		if x == tracked.x && y == tracked.y && z == tracked.z && yaw == tracked.yaw && pitch == tracked.pitch {
+			continue
+		}
+
+		tracked.x = x
+		tracked.y = y
+		tracked.z = z
+		tracked.yaw = yaw
+		tracked.pitch = pitch
+
+		chunkX, chunkZ := server.trackingChunk(x, z)
+		if chunkX != tracked.chunkX || chunkZ != tracked.chunkZ {
+			server.moveTrackedEntity(tracked, chunkX, chunkZ)
+		}
+
+		id := tracked.entity.Id()
+		server.broadcast(id, &protocol.EntityTeleportPacket{
+			EntityId: id,
+			X:        absoluteInt(x),
+			Y:        absoluteInt(y),
+			Z:        absoluteInt(z),
+			Yaw:      packedAngle(yaw),
+			Pitch:    packedAngle(pitch),
+		})
+	}
+}
+
+func (server *Server) moveTrackedEntity(tracked *trackedEntity, chunkX, chunkZ int) {
+	id := tracked.entity.Id()
+	oldIndex := server.indexedEntities(tracked.chunkX, tracked.chunkZ)
+	newIndex := server.indexedEntities(chunkX, chunkZ)
+
+	oldIndex.removeEntity(id)
+	newIndex.entities = append(newIndex.entities, tracked.entity)
+	tracked.chunkX = chunkX
+	tracked.chunkZ = chunkZ
+
+	destroy := &protocol.DestroyEntityPacket{EntityId: id}
+	for _, observer := range oldIndex.observers {
+		if observer.Id() != id && !newIndex.hasObserver(observer) {
+			observer.queuePacket(destroy)
+		}
+	}
+
+	for _, observer := range newIndex.observers {
+		if observer.Id() != id && !oldIndex.hasObserver(observer) {
+			tracked.entity.showTo(observer)
+		}
+	}
+}
+
+// Sends a packet to everything observing the chunk the entity is in, except
+// for the entity itself
+func (server *Server) broadcast(entityId int32, packet protocol.OutboundPacket) {
+	tracked, ok := server.entities[entityId]
+	if !ok {
+		return
+	}
+
+	for _, observer := range server.indexedEntities(tracked.chunkX, tracked.chunkZ).observers {
+		if observer.Id() != entityId {
+			observer.queuePacket(packet)
+		}
+	}
+}
+
+// Sends a packet to every player in the world
+func (server *Server) broadcastAll(packet protocol.OutboundPacket) {
+	for _, tracked := range server.entities {
+		if observer, ok := tracked.entity.(chunkObserver); ok {
+			observer.queuePacket(packet)
+		}
+	}
+}
+
+// Returns the chunk whose index an entity at the position belongs to. Entities
+// outside the world are indexed by the closest chunk.
+func (server *Server) trackingChunk(x, z float64) (int, int) {
+	maxChunk := server.chunkDiameter - 1
+	chunkX := util.IMin(util.IMax(int(math.Floor(x/16)), 0), maxChunk)
+	chunkZ := util.IMin(util.IMax(int(math.Floor(z/16)), 0), maxChunk)
+	return chunkX, chunkZ
+}
+
 func (server *Server) addChunkObserver(chunkX, chunkZ int, observer chunkObserver) {
 	index := server.indexedEntities(chunkX, chunkZ)
 	index.observers = append(index.observers, observer)
@@ -129,12 +380,24 @@ func (server *Server) addChunkObserver(chunkX, chunkZ int, observer chunkObserve
 	if chunk != nil {
 		observer.sendChunk(chunkX, chunkZ, chunk)
 	}
+
+	for _, entity := range index.entities {
+		if entity.Id() != observer.Id() {
+			entity.showTo(observer)
+		}
+	}
 }
 
 func (server *Server) removeChunkObserver(chunkX, chunkZ int, observer chunkObserver) {
 	index := server.indexedEntities(chunkX, chunkZ)
 	for i, obs := range index.observers {
 		if obs == observer {
+			for _, entity := range index.entities {
+				if entity.Id() != observer.Id() {
+					observer.queuePacket(&protocol.DestroyEntityPacket{EntityId: entity.Id()})
+				}
+			}
+
 			observer.unloadChunk(chunkX, chunkZ)
 			index.observers = append(index.observers[:i], index.observers[i+1:]...)
 			break
@@ -162,6 +425,10 @@ func (server *Server) ChunkFromBlockPos(x, z int) *Chunk {
 }
 
 func (server *Server) GetBlock(x, y, z int) blocks.Block {
+	if x < 0 || y < 0 || y >= 128 || z < 0 {
+		return blocks.Block{}
+	}
+
 	ch := server.ChunkFromBlockPos(x, z)
 	if ch == nil {
 		return blocks.Block{}
@@ -172,6 +439,10 @@ func (server *Server) GetBlock(x, y, z int) blocks.Block {
 }
 
 func (server *Server) SetBlock(x, y, z int, block blocks.Block) bool {
+	if x < 0 || y < 0 || y >= 128 || z < 0 {
+		return false
+	}
+
 	chunkX := x / 16
 	chunkZ := z / 16
 
@@ -197,8 +468,110 @@ func (server *Server) indexedEntities(chunkX, chunkZ int) *indexedEntities {
 	return &server.entityTracker[chunkZ*server.chunkDiameter+chunkX]
 }
 
-// Stops all running server processes. The function will block until all
-// processes have stopped.
-func (server *Server) Shutdown() {
+func (index *indexedEntities) removeEntity(id int32) {
+	for i, entity := range index.entities {
+		if entity.Id() == id {
+			index.entities = append(index.entities[:i], index.entities[i+1:]...)
+			return
+		}
+	}
+}
+
+func (index *indexedEntities) hasObserver(observer chunkObserver) bool {
+	for _, obs := range index.observers {
+		if obs == observer {
+			return true
+		}
+	}
+	return false
+}
+
+// Message shown to players when the server shuts down
+const shutdownMessage = "Server closed"
+
+func (server *Server) goroutines() *sync.WaitGroup {
+	return server.goroutineGroup
+}
+
+// Shuts down the listener set with SetListener, then stops the world, saves it,
+// and kicks every player. Blocks until everything queued for the players has
+// been sent and their connections are closed, or until the context is done, in
+// which case the remaining connections are closed without waiting for them.
+// Tick must not be called afterwards. Errors from saving and waiting are both
+// returned.
+func (server *Server) Shutdown(ctx context.Context) error {
+	listenerErr := server.shutdownListener(ctx)
+	saveErr := server.stop()
+	err := waitForGoroutines(ctx, server.goroutineGroup, server.closeConnections)
+	return errors.Join(listenerErr, saveErr, err)
+}
+
+// Sets the listener that players join the world through so that it's shut down
+// with the world. Worlds in a universe share the listener.
+func (server *Server) SetListener(listener *Listener) {
+	if server.universe != nil {
+		server.universe.listener = listener
+		return
+	}
+	server.listener = listener
+}
+
+func (server *Server) shutdownListener(ctx context.Context) error {
+	listener := server.listener
+	if server.universe != nil {
+		listener = server.universe.listener
+	}
+	if listener == nil {
+		return nil
+	}
+	return listener.Shutdown(ctx)
+}
+
+type kickable interface {
+	Kick(reason string)
+}
+
+type connectionCloser interface {
+	closeConnection()
+}
+
+// Saves the world and kicks every player without waiting for them to leave
+func (server *Server) stop() error {
 	server.ticker.Stop()
+
+	err := server.Save()
+	for _, tracked := range server.entities {
+		if player, ok := tracked.entity.(kickable); ok {
+			player.Kick(shutdownMessage)
+		}
+	}
+	return err
+}
+
+// Forcibly closes every player's connection, even if packets haven't been sent
+func (server *Server) closeConnections() {
+	for _, tracked := range server.entities {
+		if player, ok := tracked.entity.(connectionCloser); ok {
+			player.closeConnection()
+		}
+	}
+}
+
+// Waits for the group to finish. If the context is done first, cancel is
+// called to make the goroutines exit and the context's error is returned
+// without waiting for them.
+func waitForGoroutines(ctx context.Context, group *sync.WaitGroup, cancel func()) error {
+	done := make(chan struct{})
+	go func() {
+		group.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,115 @@
+package oneworld
+
+import (
+	"math"
+
+	"github.com/richgrov/oneworld/internal/util"
+)
+
+// Entity queries are answered using the chunk indices in entityTracker, which
+// are updated at the end of every tick. Entities that moved to another chunk
+// during the current tick may not be found until the next one.
+
+// Implemented by all players so they can be told apart from other entities
+type playerEntity interface {
+	Entity
+	isPlayer()
+}
+
+// Returns all entities whose position is within the radius of the point
+func (server *Server) EntitiesInRadius(x, y, z, radius float64) []Entity {
+	result := make([]Entity, 0)
+	radiusSq := radius * radius
+
+	server.forEachIndexInArea(x-radius, z-radius, x+radius, z+radius, func(index *indexedEntities) {
+		for _, entity := range index.entities {
+			ex, ey, ez := entity.Pos()
+			dx, dy, dz := ex-x, ey-y, ez-z
+			if dx*dx+dy*dy+dz*dz <= radiusSq {
+				result = append(result, entity)
+			}
+		}
+	})
+
+	return result
+}
+
+// Returns all entities whose position is inside the box, including its edges
+func (server *Server) EntitiesInAABB(minX, minY, minZ, maxX, maxY, maxZ float64) []Entity {
+	result := make([]Entity, 0)
+
+	server.forEachIndexInArea(minX, minZ, maxX, maxZ, func(index *indexedEntities) {
+		for _, entity := range index.entities {
+			ex, ey, ez := entity.Pos()
+			if ex >= minX && ex <= maxX && ey >= minY && ey <= maxY && ez >= minZ && ez <= maxZ {
+				result = append(result, entity)
+			}
+		}
+	})
+
+	return result
+}
+
+// Returns the closest player within maxDistance of the point, or nil if there
+// is none. Chunks are searched in rings of increasing distance, so only the
+// area around the point is visited when a player is nearby.
+func (server *Server) NearestPlayer(x, y, z, maxDistance float64) Entity {
+	var nearest Entity
+	nearestDistSq := maxDistance * maxDistance
+
+	centerX, centerZ := server.trackingChunk(x, z)
+	maxChunk := server.chunkDiameter - 1
+
+	for ring := 0; ring <= maxChunk; ring++ {
+		// Any chunk in this ring is at least this far away horizontally
+		ringDist := float64(ring-1) * 16
+		if ring > 0 && ringDist*ringDist > nearestDistSq {
+			break
+		}
+
+		for cx := centerX - ring; cx <= centerX+ring; cx++ {
+			if cx < 0 || cx > maxChunk {
+				continue
+			}
+
+			for cz := centerZ - ring; cz <= centerZ+ring; cz++ {
+				onRing := util.IAbs(cx-centerX) == ring || util.IAbs(cz-centerZ) == ring
+				if cz < 0 || cz > maxChunk || !onRing {
+					continue
+				}
+
+				for _, entity := range server.indexedEntities(cx, cz).entities {
+					if _, ok := entity.(playerEntity); !ok {
+						continue
+					}
+
+					ex, ey, ez := entity.Pos()
+					dx, dy, dz := ex-x, ey-y, ez-z
+					if distSq := dx*dx + dy*dy + dz*dz; distSq <= nearestDistSq {
+						nearest = entity
+						nearestDistSq = distSq
+					}
+				}
+			}
+		}
+	}
+
+	return nearest
+}
+
+// Calls the function for every chunk index overlapping the horizontal area.
+// Entities outside the world are indexed by the closest chunk, so the area is
+// clamped rather than skipped.
+func (server *Server) forEachIndexInArea(minX, minZ, maxX, maxZ float64, f func(*indexedEntities)) {
+	maxChunk := server.chunkDiameter - 1
+	minChunkX := util.IMin(util.IMax(int(math.Floor(minX/16)), 0), maxChunk)
+	minChunkZ := util.IMin(util.IMax(int(math.Floor(minZ/16)), 0), maxChunk)
+	maxChunkX := util.IMin(util.IMax(int(math.Floor(maxX/16)), 0), maxChunk)
+	maxChunkZ := util.IMin(util.IMax(int(math.Floor(maxZ/16)), 0), maxChunk)
+
+	for cx := minChunkX; cx <= maxChunkX; cx++ {
+		for cz := minChunkZ; cz <= maxChunkZ; cz++ {
+			f(server.indexedEntities(cx, cz))
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package oneworld
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type fakePlayer struct {
+	EntityBase
+}
+
+func (*fakePlayer) isPlayer() {}
+
+// Creates a server with no chunks loaded and the specified number of entities
+// spread randomly over it, including a few blocks past its edges. Every
+// playerEvery'th entity is a player.
+func newSpatialServer(tb testing.TB, chunkDiameter, entityCount, playerEvery int) *Server {
+	server, err := NewServer(chunkDiameter, make([]*Chunk, chunkDiameter*chunkDiameter))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	rng := rand.New(rand.NewSource(1))
+	size := float64(chunkDiameter * 16)
+
+	for i := 0; i < entityCount; i++ {
+		base := server.AllocateEntity(rng.Float64()*(size+20)-10, rng.Float64()*128, rng.Float64()*(size+20)-10)
+		if i%playerEvery == 0 {
+			server.AddEntity(&fakePlayer{base})
+		} else {
+			server.AddEntity(&base)
+		}
+	}
+
+	return server
+}
+
+func sortedIds(entities []Entity) []int32 {
+	ids := make([]int32, len(entities))
+	for i, entity := range entities {
+		ids[i] = entity.Id()
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func scanEntities(server *Server, include func(x, y, z float64) bool) []Entity {
+	result := make([]Entity, 0)
+	for _, tracked := range server.entities {
+		if include(tracked.entity.Pos()) {
+			result = append(result, tracked.entity)
+		}
+	}
+	return result
+}
+
+func TestEntitiesInRadius(t *testing.T) {
+	server := newSpatialServer(t, 8, 2000, 10)
+	rng := rand.New(rand.NewSource(2))
+
+	for i := 0; i < 100; i++ {
+		x, y, z := rng.Float64()*140-6, rng.Float64()*128, rng.Float64()*140-6
+		radius := rng.Float64() * 40
+
+		expected := scanEntities(server, func(ex, ey, ez float64) bool {
+			dx, dy, dz := ex-x, ey-y, ez-z
+			return dx*dx+dy*dy+dz*dz <= radius*radius
+		})
+
+		actual := server.EntitiesInRadius(x, y, z, radius)
+		if fmt.Sprint(sortedIds(actual)) != fmt.Sprint(sortedIds(expected)) {
+			t.Fatalf("radius %f around (%f, %f, %f): expected %v but got %v", radius, x, y, z, sortedIds(expected), sortedIds(actual))
+		}
+	}
+}
+
+func TestEntitiesInAABB(t *testing.T) {
+	server := newSpatialServer(t, 8, 2000, 10)
+	rng := rand.New(rand.NewSource(3))
+
+	for i := 0; i < 100; i++ {
+		minX, minY, minZ := rng.Float64()*140-6, rng.Float64()*128, rng.Float64()*140-6
+		maxX, maxY, maxZ := minX+rng.Float64()*40, minY+rng.Float64()*40, minZ+rng.Float64()*40
+
+		expected := scanEntities(server, func(x, y, z float64) bool {
+			return x >= minX && x <= maxX && y >= minY && y <= maxY && z >= minZ && z <= maxZ
+		})
+
+		actual := server.EntitiesInAABB(minX, minY, minZ, maxX, maxY, maxZ)
+		if fmt.Sprint(sortedIds(actual)) != fmt.Sprint(sortedIds(expected)) {
+			t.Fatalf("expected %v but got %v", sortedIds(expected), sortedIds(actual))
+		}
+	}
+}
+
+func TestNearestPlayer(t *testing.T) {
+	server := newSpatialServer(t, 8, 2000, 50)
+	rng := rand.New(rand.NewSource(4))
+
+	for i := 0; i < 100; i++ {
+		x, y, z := rng.Float64()*140-6, rng.Float64()*128, rng.Float64()*140-6
+		maxDistance := rng.Float64() * 100
+
+		var expected Entity
+		expectedDistSq := math.Inf(1)
+		for _, tracked := range server.entities {
+			if _, ok := tracked.entity.(playerEntity); !ok {
+				continue
+			}
+
+			ex, ey, ez := tracked.entity.Pos()
+			dx, dy, dz := ex-x, ey-y, ez-z
+			if distSq := dx*dx + dy*dy + dz*dz; distSq <= maxDistance*maxDistance && distSq < expectedDistSq {
+				expected = tracked.entity
+				expectedDistSq = distSq
+			}
+		}
+
+		if actual := server.NearestPlayer(x, y, z, maxDistance); actual != expected {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	}
+}
+
+func TestIndexFollowsMovement(t *testing.T) {
+	server := newSpatialServer(t, 4, 0, 1)
+	base := server.AllocateEntity(1, 1, 1)
+	entity := &base
+	server.AddEntity(entity)
+
+	entity.x = 50
+	entity.z = 50
+	server.Tick()
+
+	if found := server.EntitiesInRadius(1, 1, 1, 2); len(found) != 0 {
+		t.Fatalf("entity still found at old position: %v", found)
+	}
+
+	if found := server.EntitiesInRadius(50, 1, 50, 2); len(found) != 1 {
+		t.Fatalf("entity not found at new position: %v", found)
+	}
+
+	server.RemoveEntity(entity.Id())
+	if found := server.EntitiesInRadius(50, 1, 50, 2); len(found) != 0 {
+		t.Fatalf("entity found after removal: %v", found)
+	}
+}
+
+// The world grows with the number of entities so that density stays the same,
+// as it would on a real server. Indexed queries should take roughly constant
+// time, while scans grow linearly.
+var benchmarkSizes = []int{1000, 10000}
+
+func benchmarkDiameter(entityCount int) int {
+	return int(math.Sqrt(float64(entityCount) / 4))
+}
+
+func BenchmarkEntitiesInRadius(b *testing.B) {
+	for _, count := range benchmarkSizes {
+		b.Run(fmt.Sprint(count), func(b *testing.B) {
+			diameter := benchmarkDiameter(count)
+			server := newSpatialServer(b, diameter, count, 100)
+			center := float64(diameter * 8)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				server.EntitiesInRadius(center, 64, center, 16)
+			}
+		})
+	}
+}
+
+func BenchmarkEntitiesInRadiusScan(b *testing.B) {
+	for _, count := range benchmarkSizes {
+		b.Run(fmt.Sprint(count), func(b *testing.B) {
+			diameter := benchmarkDiameter(count)
+			server := newSpatialServer(b, diameter, count, 100)
+			center := float64(diameter * 8)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				scanEntities(server, func(x, y, z float64) bool {
+					dx, dy, dz := x-center, y-64, z-center
+					return dx*dx+dy*dy+dz*dz <= 16*16
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkEntitiesInAABB(b *testing.B) {
+	for _, count := range benchmarkSizes {
+		b.Run(fmt.Sprint(count), func(b *testing.B) {
+			diameter := benchmarkDiameter(count)
+			server := newSpatialServer(b, diameter, count, 100)
+			center := float64(diameter * 8)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				server.EntitiesInAABB(center-8, 0, center-8, center+8, 128, center+8)
+			}
+		})
+	}
+}
+
+func BenchmarkNearestPlayer(b *testing.B) {
+	for _, count := range benchmarkSizes {
+		b.Run(fmt.Sprint(count), func(b *testing.B) {
+			diameter := benchmarkDiameter(count)
+			server := newSpatialServer(b, diameter, count, 100)
+			center := float64(diameter * 8)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				server.NearestPlayer(center, 64, center, 64)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package oneworld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A group of worlds hosted by the same process that players can travel
+// between, one for each dimension. Each world has its own chunks, entities, and
+// tick, but all of them must be ticked from the same goroutine.
+type Universe struct {
+	worlds []*Server
+	// Shared by every world so that players are found wherever they left
+	playerDataDir string
+	listener      *Listener
+}
+
+// Links the worlds together and sets the dimension of each. Entity IDs are
+// shared between the worlds afterwards so that entities can move between them.
+func NewUniverse(worlds map[Dimension]*Server) (*Universe, error) {
+	if len(worlds) == 0 {
+		return nil, errors.New("universe must have at least one world")
+	}
+
+	universe := &Universe{worlds: make([]*Server, 0, len(worlds))}
+	nextEntityId := new(int32)
+	goroutineGroup := new(sync.WaitGroup)
+
+	for dimension, world := range worlds {
+		if world.universe != nil {
+			return nil, fmt.Errorf("world for dimension %d is already part of a universe", dimension)
+		}
+
+		if *world.nextEntityId > *nextEntityId {
+			*nextEntityId = *world.nextEntityId
+		}
+
+		// Keep a directory that was set before the worlds were linked
+		if world.playerDataDir != "" {
+			if universe.playerDataDir != "" && universe.playerDataDir != world.playerDataDir {
+				return nil, fmt.Errorf("worlds save players to both %s and %s", universe.playerDataDir, world.playerDataDir)
+			}
+			universe.playerDataDir = world.playerDataDir
+		}
+		if world.listener != nil {
+			if universe.listener != nil && universe.listener != world.listener {
+				return nil, errors.New("worlds have different listeners")
+			}
+			universe.listener = world.listener
+		}
+	}
+
+	for dimension, world := range worlds {
+		world.dimension = dimension
+		world.universe = universe
+		world.nextEntityId = nextEntityId
+		world.goroutineGroup = goroutineGroup
+		universe.worlds = append(universe.worlds, world)
+	}
+
+	sort.Slice(universe.worlds, func(i, j int) bool {
+		return universe.worlds[i].dimension < universe.worlds[j].dimension
+	})
+
+	return universe, nil
+}
+
+// Returns the world for the dimension, or nil if there is none
+func (universe *Universe) World(dimension Dimension) *Server {
+	for _, world := range universe.worlds {
+		if world.dimension == dimension {
+			return world
+		}
+	}
+	return nil
+}
+
+func (universe *Universe) Tick() {
+	for _, world := range universe.worlds {
+		world.Tick()
+	}
+}
+
+// Returns the number of players in all of the worlds. Safe to call from any
+// goroutine.
+func (universe *Universe) OnlinePlayers() int {
+	online := 0
+	for _, world := range universe.worlds {
+		online += world.OnlinePlayers()
+	}
+	return online
+}
+
+// Shuts down every world like Server.Shutdown. Worlds are all stopped before
+// waiting because players can have moved between them.
+func (universe *Universe) Shutdown(ctx context.Context) error {
+	errs := []error{universe.worlds[0].shutdownListener(ctx)}
+	for _, world := range universe.worlds {
+		errs = append(errs, world.stop())
+	}
+
+	closeConnections := func() {
+		for _, world := range universe.worlds {
+			world.closeConnections()
+		}
+	}
+
+	// The group is shared, so waiting on any world's waits for all of them
+	errs = append(errs, waitForGoroutines(ctx, universe.worlds[0].goroutineGroup, closeConnections))
+	return errors.Join(errs...)
+}
+
+// Sets the listener that players join the universe through so that it's shut
+// down with the worlds
+func (universe *Universe) SetListener(listener *Listener) {
+	universe.listener = listener
+}
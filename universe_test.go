@@ -0,0 +1,191 @@
+package oneworld
+
+import (
+	"context"
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+func TestPortalCoordinates(t *testing.T) {
+	x, z := PortalCoordinates(80, -16, Overworld, Nether)
+	if x != 10 || z != -2 {
+		t.Errorf("overworld to nether: %f, %f", x, z)
+	}
+
+	x, z = PortalCoordinates(10, -2, Nether, Overworld)
+	if x != 80 || z != -16 {
+		t.Errorf("nether to overworld: %f, %f", x, z)
+	}
+
+	x, z = PortalCoordinates(10, -2, Overworld, Sky)
+	if x != 10 || z != -2 {
+		t.Errorf("overworld to sky: %f, %f", x, z)
+	}
+}
+
+// Creates a player in the Overworld of a universe that also has a Nether with
+// a netherrack floor at the same height
+func newUniversePlayer(t *testing.T) (*PlayerBase[*Server], *Server) {
+	player, _ := newMovementPlayer(t)
+	player.portal.left = true
+	overworld := player.Server
+
+	chunk := new(Chunk)
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			chunk.Set(x, movementFloorY, z, blocks.Block{Type: blocks.Netherrack})
+		}
+	}
+
+	nether, err := NewServer(1, []*Chunk{chunk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nether.Shutdown(context.Background()) })
+
+	if _, err := NewUniverse(map[Dimension]*Server{Overworld: overworld, Nether: nether}); err != nil {
+		t.Fatal(err)
+	}
+
+	overworld.AddEntity(player)
+	return player, nether
+}
+
+func TestNewUniverse(t *testing.T) {
+	player, nether := newUniversePlayer(t)
+
+	if nether.Dimension() != Nether || player.Server.World(Nether) != nether || nether.World(Overworld) != player.Server {
+		t.Fatal("worlds weren't linked")
+	}
+
+	if entity := nether.AllocateEntity(0, 0, 0); entity.Id() == player.Id() {
+		t.Fatalf("entity ID %d was reused", entity.Id())
+	}
+
+	if _, err := NewUniverse(map[Dimension]*Server{Nether: nether}); err == nil {
+		t.Fatal("world was added to a second universe")
+	}
+}
+
+func TestStartInDimension(t *testing.T) {
+	player, nether := newUniversePlayer(t)
+	overworld := player.Server
+
+	conn := &AcceptedConnection{Username: "Herobrine"}
+	started := NewBasePlayer(overworld.AllocateEntity(8.5, movementFloorY+1, 8.5), overworld, conn, 1, 0, Nether, new(violationRecorder))
+	if started.Server != nether || started.dimension != Nether {
+		t.Fatalf("player started in dimension %d", started.dimension)
+	}
+}
+
+func TestPlayerDataSharedBetweenWorlds(t *testing.T) {
+	player, nether := newUniversePlayer(t)
+	overworld := player.Server
+	overworld.SetPlayerDataDir(t.TempDir())
+	if nether.PlayerDataDir() != overworld.PlayerDataDir() {
+		t.Fatalf("worlds save players to %q and %q", overworld.PlayerDataDir(), nether.PlayerDataDir())
+	}
+
+	player.ChangeWorld(nether, 1.5, movementFloorY+1, 1.5)
+	nether.RemoveEntity(player.Id())
+	if err := player.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Players always join through the overworld
+	rejoined := newTestPlayer(t, overworld, 8.5, movementFloorY+1, 8.5, new(violationRecorder))
+	if rejoined.Server != nether || rejoined.x != 1.5 || rejoined.z != 1.5 {
+		t.Fatalf("player rejoined at %f, %f in dimension %d", rejoined.x, rejoined.z, rejoined.dimension)
+	}
+}
+
+func TestConflictingPlayerDataDirs(t *testing.T) {
+	worlds := make(map[Dimension]*Server)
+	for dimension, dir := range map[Dimension]string{Overworld: "players", Nether: "nether/players"} {
+		world, err := NewServer(1, []*Chunk{new(Chunk)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		world.SetPlayerDataDir(dir)
+		worlds[dimension] = world
+	}
+
+	if _, err := NewUniverse(worlds); err == nil {
+		t.Fatal("worlds with different player directories were linked")
+	}
+}
+
+func TestOnlinePlayers(t *testing.T) {
+	player, nether := newUniversePlayer(t)
+	overworld := player.Server
+	universe := overworld.universe
+
+	// Only players are counted
+	overworld.LaunchProjectile(SnowballProjectile, -1, 8, 20, 8, 0, 0, 0)
+	if overworld.OnlinePlayers() != 1 || nether.OnlinePlayers() != 0 || universe.OnlinePlayers() != 1 {
+		t.Fatalf("counted %d and %d players", overworld.OnlinePlayers(), nether.OnlinePlayers())
+	}
+
+	player.ChangeWorld(nether, 8.5, movementFloorY+1, 8.5)
+	if overworld.OnlinePlayers() != 0 || nether.OnlinePlayers() != 1 || universe.OnlinePlayers() != 1 {
+		t.Fatalf("counted %d and %d players after changing worlds", overworld.OnlinePlayers(), nether.OnlinePlayers())
+	}
+
+	nether.RemoveEntity(player.Id())
+	if universe.OnlinePlayers() != 0 {
+		t.Fatalf("counted %d players after leaving", universe.OnlinePlayers())
+	}
+}
+
+func TestTravelThroughPortal(t *testing.T) {
+	player, nether := newUniversePlayer(t)
+	overworld := player.Server
+	overworld.SetBlock(8, movementFloorY+1, 8, blocks.Block{Type: blocks.Portal})
+
+	for i := 0; i < portalDelayTicks-1; i++ {
+		player.tickPortal()
+	}
+	if player.Server != overworld {
+		t.Fatal("traveled before the portal delay")
+	}
+
+	// Discard everything sent before traveling
+	queuedPackets(player)
+
+	player.tickPortal()
+	if player.Server != nether || player.dimension != Nether {
+		t.Fatal("player didn't travel to the nether")
+	}
+
+	if overworld.entity(player.id) != nil || nether.entity(player.id) == nil {
+		t.Fatal("player wasn't moved between worlds")
+	}
+
+	sentRespawn := false
+	for _, packet := range queuedPackets(player) {
+		if packet[0] == protocol.RespawnId && Dimension(packet[1]) == Nether {
+			sentRespawn = true
+		}
+	}
+	if !sentRespawn {
+		t.Fatal("respawn packet wasn't sent")
+	}
+
+	// 8.5 / 8 is rounded down to block 1 in the nether
+	if player.x != 1.5 || player.y != movementFloorY+1 || player.z != 1.5 {
+		t.Fatalf("arrived at %f, %f, %f", player.x, player.y, player.z)
+	}
+	if block := nether.GetBlock(1, movementFloorY+1, 1); block.Type != blocks.Portal {
+		t.Fatalf("no portal was built, found %v", block)
+	}
+
+	// Standing in the destination portal doesn't send the player back
+	for i := 0; i < portalDelayTicks*2; i++ {
+		player.tickPortal()
+	}
+	if player.Server != nether {
+		t.Fatal("player was sent back before leaving the portal")
+	}
+}
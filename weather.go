@@ -0,0 +1,171 @@
+package oneworld
+
+import (
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+type Weather int
+
+const (
+	WeatherClear Weather = iota
+	// Rain falls as snow in cold biomes
+	WeatherRain
+	WeatherThunder
+)
+
+// Ranges of how long each kind of weather lasts, in ticks, as chosen by the
+// vanilla server
+const (
+	minRainTicks      = 12000
+	rainTicksRange    = 12000
+	minThunderTicks   = 3600
+	thunderTicksRange = 12000
+	minClearTicks     = 12000
+	clearTicksRange   = 168000
+)
+
+// Every chunk has a 1 in this chance of being struck by lightning each tick
+// during a thunderstorm
+const lightningChance = 100000
+
+const (
+	lightningDamage = 5
+	// Entities within this many blocks of a strike are damaged. The area
+	// extends further upwards to cover the bolt.
+	lightningRadius = 3
+	lightningHeight = 6
+)
+
+// Rain and thunder change independently, but thunder only has an effect while
+// it's raining. A duration of 0 means a random one is picked on the next tick.
+type weatherState struct {
+	raining      bool
+	rainTicks    int32
+	thundering   bool
+	thunderTicks int32
+}
+
+func (server *Server) Weather() Weather {
+	switch {
+	case server.weather.raining && server.weather.thundering:
+		return WeatherThunder
+	case server.weather.raining:
+		return WeatherRain
+	default:
+		return WeatherClear
+	}
+}
+
+// Changes the weather for the number of ticks, after which it changes
+// randomly again. A duration of 0 or less picks a random one.
+func (server *Server) SetWeather(weather Weather, duration int32) {
+	wasRaining := server.weather.raining
+	server.weather.raining = weather != WeatherClear
+	server.weather.thundering = weather == WeatherThunder
+
+	if duration < 0 {
+		duration = 0
+	}
+	server.weather.rainTicks = duration
+	server.weather.thunderTicks = duration
+
+	if server.weather.raining != wasRaining {
+		server.broadcastAll(rainPacket(server.weather.raining))
+	}
+}
+
+func (server *Server) randomWeatherDuration(active bool, min, spread int32) int32 {
+	if active {
+		return min + server.random.Int31n(spread)
+	}
+	return minClearTicks + server.random.Int31n(clearTicksRange)
+}
+
+func rainPacket(raining bool) *protocol.NewStatePacket {
+	if raining {
+		return &protocol.NewStatePacket{Reason: protocol.StateBeginRain}
+	}
+	return &protocol.NewStatePacket{Reason: protocol.StateEndRain}
+}
+
+func (server *Server) tickWeather() {
+	// There's no weather in the Nether
+	if server.dimension == Nether {
+		return
+	}
+
+	state := &server.weather
+
+	if state.thunderTicks <= 0 {
+		state.thunderTicks = server.randomWeatherDuration(state.thundering, minThunderTicks, thunderTicksRange)
+	} else {
+		state.thunderTicks--
+		if state.thunderTicks == 0 {
+			state.thundering = !state.thundering
+		}
+	}
+
+	if state.rainTicks <= 0 {
+		state.rainTicks = server.randomWeatherDuration(state.raining, minRainTicks, rainTicksRange)
+	} else {
+		state.rainTicks--
+		if state.rainTicks == 0 {
+			state.raining = !state.raining
+			server.broadcastAll(rainPacket(state.raining))
+		}
+	}
+
+	if !state.raining || !state.thundering {
+		return
+	}
+
+	for chunkX := 0; chunkX < server.chunkDiameter; chunkX++ {
+		for chunkZ := 0; chunkZ < server.chunkDiameter; chunkZ++ {
+			if server.random.Intn(lightningChance) != 0 {
+				continue
+			}
+
+			x := chunkX*16 + server.random.Intn(16)
+			z := chunkZ*16 + server.random.Intn(16)
+			server.StrikeLightning(x, server.highestBlock(x, z)+1, z)
+		}
+	}
+}
+
+// Returns the Y coordinate of the highest non-air block in the column, or -1
+// if the column is empty
+func (server *Server) highestBlock(x, z int) int {
+	for y := 127; y >= 0; y-- {
+		if server.GetBlock(x, y, z).Type != blocks.Air {
+			return y
+		}
+	}
+	return -1
+}
+
+// Strikes lightning at the block, which sets it on fire if it's empty and
+// damages nearby entities
+func (server *Server) StrikeLightning(x, y, z int) {
+	bolt := server.AllocateEntity(float64(x)+0.5, float64(y), float64(z)+0.5)
+	server.broadcastAll(&protocol.ThunderboltPacket{
+		EntityId: bolt.id,
+		X:        absoluteInt(bolt.x),
+		Y:        absoluteInt(bolt.y),
+		Z:        absoluteInt(bolt.z),
+	})
+
+	if server.GetBlock(x, y, z).Type == blocks.Air && server.GetBlock(x, y-1, z).Solid() {
+		server.SetBlock(x, y, z, blocks.Block{Type: blocks.Fire})
+	}
+
+	entities := server.EntitiesInAABB(
+		bolt.x-lightningRadius, bolt.y-lightningRadius, bolt.z-lightningRadius,
+		bolt.x+lightningRadius, bolt.y+lightningHeight+lightningRadius, bolt.z+lightningRadius,
+	)
+	for _, entity := range entities {
+		if damageable, ok := entity.(Damageable); ok {
+			damageable.Damage(lightningDamage, 0, 0, 0)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package oneworld
+
+import (
+	"testing"
+
+	"github.com/richgrov/oneworld/blocks"
+	"github.com/richgrov/oneworld/internal/protocol"
+)
+
+// Returns the reasons of all new state packets the player was sent
+func newStateReasons(player *PlayerBase[*Server]) []byte {
+	reasons := make([]byte, 0)
+	for _, packet := range queuedPackets(player) {
+		if packet[0] == protocol.NewStateId {
+			reasons = append(reasons, packet[1])
+		}
+	}
+	return reasons
+}
+
+func TestSetWeather(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	server := player.Server
+	server.AddEntity(player)
+	newStateReasons(player)
+
+	server.SetWeather(WeatherRain, 2)
+	if server.Weather() != WeatherRain {
+		t.Fatalf("weather is %d", server.Weather())
+	}
+
+	// Becoming a thunderstorm doesn't start the rain again
+	server.SetWeather(WeatherThunder, 2)
+	if reasons := newStateReasons(player); len(reasons) != 1 || reasons[0] != protocol.StateBeginRain {
+		t.Fatalf("sent new states %v", reasons)
+	}
+
+	server.Tick()
+	server.Tick()
+	if server.Weather() != WeatherClear {
+		t.Fatalf("weather is %d after its duration ended", server.Weather())
+	}
+	if reasons := newStateReasons(player); len(reasons) != 1 || reasons[0] != protocol.StateEndRain {
+		t.Fatalf("sent new states %v", reasons)
+	}
+
+	// The next duration is random
+	server.Tick()
+	if server.weather.rainTicks < minClearTicks || server.weather.thunderTicks < minClearTicks {
+		t.Fatalf("picked durations %d and %d", server.weather.rainTicks, server.weather.thunderTicks)
+	}
+}
+
+func TestStrikeLightning(t *testing.T) {
+	player, _ := newMovementPlayer(t)
+	server := player.Server
+	server.AddEntity(player)
+	player.health = maxHealth
+
+	server.StrikeLightning(9, movementFloorY+1, 9)
+
+	if block := server.GetBlock(9, movementFloorY+1, 9); block.Type != blocks.Fire {
+		t.Errorf("lightning left %v", block)
+	}
+	if player.health != maxHealth-lightningDamage {
+		t.Errorf("player has %d health", player.health)
+	}
+
+	// Lightning isn't an entity that stays in the world
+	if len(server.entities) != 1 {
+		t.Errorf("world has %d entities", len(server.entities))
+	}
+}
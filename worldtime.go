@@ -0,0 +1,39 @@
+package oneworld
+
+import "github.com/richgrov/oneworld/internal/protocol"
+
+// Number of ticks in a full day and night
+const ticksPerDay = 24000
+
+// How often the time is sent to players, in ticks. Clients advance the time
+// on their own in between.
+const timeSyncInterval = ticksPerSecond
+
+// Returns the number of ticks the world has existed for. The time of day is
+// this modulo 24000, with 0 being sunrise.
+func (server *Server) Time() int64 {
+	return server.time
+}
+
+// Sets the world time and sends it to every player
+func (server *Server) SetTime(time int64) {
+	server.time = time
+	server.broadcastAll(&protocol.TimeUpdatePacket{Time: time})
+}
+
+// Sets how many ticks the world time advances by each server tick. 0 freezes
+// the time and larger values speed it up.
+func (server *Server) SetTimeRate(rate int64) {
+	server.timeRate = rate
+}
+
+func (server *Server) TimeRate() int64 {
+	return server.timeRate
+}
+
+func (server *Server) tickTime() {
+	server.time += server.timeRate
+	if server.ticks%timeSyncInterval == 0 {
+		server.broadcastAll(&protocol.TimeUpdatePacket{Time: server.time})
+	}
+}